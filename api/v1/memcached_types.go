@@ -1,7 +1,12 @@
 package v1
 
 import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 
 	corev1 "k8s.io/api/core/v1"
 )
@@ -26,6 +31,64 @@ const (
 	ProxyDefaultImage                   = "zlodey23/twemproxy:0.5.0"
 )
 
+// Default images of the exporter sidecars added by spec.monitoring
+const (
+	ExporterDefaultImage      = "quay.io/prometheus/memcached-exporter:v0.14.2"
+	ProxyExporterDefaultImage = "zlodey23/twemproxy-exporter:0.1.0"
+)
+
+// Annotations set by the operator on the pods and pod templates it owns
+const (
+	ProxyConfigHashAnnotation = "cache.bsod.io/proxy-config-hash"
+	AuthSecretHashAnnotation  = "cache.bsod.io/auth-secret-hash"
+	// TLSSecretHashAnnotation is set on the pods serving the current certificate, and on the pod
+	// template when the certificates can only be reloaded with a restart
+	TLSSecretHashAnnotation = "cache.bsod.io/tls-secret-hash"
+	// DecommissionAnnotation marks a pod leaving on a scale down, the value is the time its drain started
+	DecommissionAnnotation = "cache.bsod.io/decommission"
+)
+
+// Scale down defaults
+const (
+	// DefaultDrainPeriod is how long a departing pod keeps running once it left the proxy pool
+	DefaultDrainPeriod = 30 * time.Second
+	// DefaultStepInterval is the pause between two scale down steps
+	DefaultStepInterval = 20 * time.Second
+	// DefaultRampUpStepInterval is how long a new proxy backend stays at each ramp-up weight
+	DefaultRampUpStepInterval = time.Minute
+)
+
+// DefaultStatsInterval is the pause between two polls of the memcached stats
+const DefaultStatsInterval = 30 * time.Second
+
+// DefaultRampUpWeights are the ramp-up weights of a new proxy backend, in percent of the full weight
+var DefaultRampUpWeights = []int32{10, 25, 50}
+
+// DefaultAuthSecretKey is the Secret key holding the credentials when Auth.SecretKey is not set
+const DefaultAuthSecretKey = "auth"
+
+// Memory defaults, in bytes
+const (
+	// DefaultCacheSize is the memcached default cache size, used when there is no container memory to derive it from
+	DefaultCacheSize int64 = 64 * 1024 * 1024
+	// DefaultMemoryHeadroom is the memory kept free for connections, threads and fragmentation
+	DefaultMemoryHeadroom int64 = 128 * 1024 * 1024
+	// DefaultExtstoreWriteBufferSize is the memcached default size of an extstore write buffer
+	DefaultExtstoreWriteBufferSize int64 = 4 * 1024 * 1024
+	// ExtstorePageSize is the size of an extstore page, the file holds at least one page
+	ExtstorePageSize int64 = 64 * 1024 * 1024
+)
+
+// Twemproxy pool defaults, used when the matching ProxyConfig field is not set
+const (
+	ProxyDefaultListen             = "0.0.0.0:11211"
+	ProxyDefaultHash               = "fnv1a_64"
+	ProxyDefaultDistribution       = "ketama"
+	ProxyDefaultServerFailureLimit = 2
+	ProxyDefaultServerRetryTimeout = 30000
+	ProxyDefaultTimeout            = 400
+)
+
 // ===============================================================================
 // MemcachedSpec defines the desired state of Memcached
 // +kubebuilder:pruning:PreserveUnknownFields
@@ -48,13 +111,73 @@ type MemcachedSpec struct {
 	Verbose VerboseLevel `json:"verbose,omitempty"`
 
 	// Parameter for setting image and tag for memcached pod
-	// default 'memcached:1.6.23-alpine'
+	// default 'memcached:1.6.23-alpine'. The probes do a version round trip with sh and nc in the
+	// default image, any other image gets TCP probes
 	// +optional
 	Image DockerImage `json:"image,omitempty"`
 
 	// Resources defines CPU and memory for Memcached pods
 	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
 
+	// Memory defines how much of the container memory is given to the cache (--memory-limit),
+	// by default the memory limit minus 128Mi
+	// +optional
+	Memory MemoryPolicy `json:"memory,omitempty"`
+
+	// Tuning sets the memcached command line options, unset fields keep the memcached default
+	// +optional
+	Tuning Tuning `json:"tuning,omitempty"`
+
+	// Extstore extends the cache onto disk, items larger than ItemSize are flushed to a file
+	// on a dedicated volume
+	// +optional
+	Extstore Extstore `json:"extstore,omitempty"`
+
+	// Auth requires clients to authenticate with the credentials from a Secret
+	// +optional
+	Auth Auth `json:"auth,omitempty"`
+
+	// TLS serves memcached over TLS with the certificate from a Secret
+	// +optional
+	TLS TLS `json:"tls,omitempty"`
+
+	// Monitoring adds Prometheus exporters to the pods, and a ServiceMonitor and a PrometheusRule
+	// when the prometheus-operator CRDs are installed
+	// +optional
+	Monitoring Monitoring `json:"monitoring,omitempty"`
+
+	// Probes overrides the timing and thresholds of the memcached probes
+	// +optional
+	Probes Probes `json:"probes,omitempty"`
+
+	// PodTemplate is merged into the generated memcached pod spec
+	// +optional
+	PodTemplate PodTemplate `json:"podTemplate,omitempty"`
+
+	// MaxUnavailable memcached pods during voluntary disruptions like node drains, an integer or
+	// a percentage of Size, default 1
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+
+	// Service defines how the memcached Service is exposed
+	// +optional
+	Service ServiceSpec `json:"service,omitempty"`
+
+	// Scaling controls how memcached pods are taken out on a scale down or deletion
+	// +optional
+	Scaling Scaling `json:"scaling,omitempty"`
+
+	// Stats polls the stats of every pod into status.stats, and sets Degraded on the thresholds
+	// +optional
+	Stats Stats `json:"stats,omitempty"`
+
+	// Specifies the workload used for the Memcached pods.
+	// Valid values are:
+	// - "Deployment"(default): pods get random names and IPs;
+	// - "StatefulSet": pods get stable names, reachable as <name>-N.<name>-headless through a headless Service;
+	// +optional
+	Topology Topology `json:"topology,omitempty"`
+
 	// This tells the controller to use or not Twemproxy.
 	// if config is not set then it will be autogenerated generated
 	// +optional
@@ -79,6 +202,407 @@ const (
 	Extreme VerboseLevel = "Extreme"
 )
 
+// MemoryPolicy struct for sizing the cache out of the container memory
+type MemoryPolicy struct {
+	// CacheSize sets the cache size explicitly, the headroom settings are ignored
+	// +optional
+	CacheSize *resource.Quantity `json:"cacheSize,omitempty"`
+	// HeadroomPercent percentage of the container memory kept out of the cache, can't be used with Headroom
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=90
+	// +optional
+	HeadroomPercent *int32 `json:"headroomPercent,omitempty"`
+	// Headroom memory kept out of the cache, can't be used with HeadroomPercent, default 128Mi
+	// +optional
+	Headroom *resource.Quantity `json:"headroom,omitempty"`
+	// Source the container memory the cache is derived from.
+	// Valid values are:
+	// - "Limits"(default): resources.limits.memory;
+	// - "Requests": resources.requests.memory;
+	// +optional
+	Source MemorySource `json:"source,omitempty"`
+}
+
+// MemorySource
+// +kubebuilder:validation:Enum=Limits;Requests
+type MemorySource string
+
+const (
+	// MemorySourceLimits derives the cache from the memory limit
+	MemorySourceLimits MemorySource = "Limits"
+
+	// MemorySourceRequests derives the cache from the memory request
+	MemorySourceRequests MemorySource = "Requests"
+)
+
+// Tuning struct for the memcached command line options
+type Tuning struct {
+	// Threads number of threads to use to process incoming requests (-t), default 4
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=256
+	// +optional
+	Threads int32 `json:"threads,omitempty"`
+	// MaxConnections max simultaneous connections (-c), default 1024
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxConnections int32 `json:"maxConnections,omitempty"`
+	// MaxItemSize adjusts max item size (-I), from 1Ki to 1Gi and at most half of the cache, default 1Mi
+	// +optional
+	MaxItemSize *resource.Quantity `json:"maxItemSize,omitempty"`
+	// GrowthFactor chunk size growth factor (-f), a decimal number greater than 1, default 1.25
+	// +kubebuilder:validation:Pattern=`^[0-9]+(\.[0-9]+)?$`
+	// +optional
+	GrowthFactor string `json:"growthFactor,omitempty"`
+	// MinSpace min space in bytes allocated for key+value+flags (-n), default 48
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MinSpace int32 `json:"minSpace,omitempty"`
+	// MaxRequestsPerEvent maximum number of requests per event, limits the requests processed
+	// per connection to prevent starvation (-R), default 20
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxRequestsPerEvent int32 `json:"maxRequestsPerEvent,omitempty"`
+	// Protocol binding protocol (-B), default auto
+	// +optional
+	Protocol Protocol `json:"protocol,omitempty"`
+	// LRUCrawler enables the background LRU crawler that reclaims expired items (-o lru_crawler), default true
+	// +optional
+	LRUCrawler *bool `json:"lruCrawler,omitempty"`
+	// LRUMaintainer enables the segmented LRU and its background maintainer thread (-o lru_maintainer), default true
+	// +optional
+	LRUMaintainer *bool `json:"lruMaintainer,omitempty"`
+	// HotLRUPercent percentage of the slab class reserved for the hot LRU (-o hot_lru_pct), default 20.
+	// Requires the LRU maintainer, hot and warm together can't take more than 80%
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=80
+	// +optional
+	HotLRUPercent int32 `json:"hotLRUPercent,omitempty"`
+	// WarmLRUPercent percentage of the slab class reserved for the warm LRU (-o warm_lru_pct), default 40.
+	// Requires the LRU maintainer, hot and warm together can't take more than 80%
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=80
+	// +optional
+	WarmLRUPercent int32 `json:"warmLRUPercent,omitempty"`
+}
+
+// Extstore struct for extending the cache onto disk
+type Extstore struct {
+	// +optional
+	Enable bool `json:"enable,omitempty"`
+	// Size of the extstore file (-o ext_path), at least 64Mi, required when enabled
+	// +optional
+	Size resource.Quantity `json:"size,omitempty"`
+	// WriteBufferSize size of the write buffer of each IO thread (-o ext_wbuf_size), below 64Mi, default 4Mi.
+	// The buffers live outside of the cache, so they have to fit in the memory headroom
+	// +optional
+	WriteBufferSize *resource.Quantity `json:"writeBufferSize,omitempty"`
+	// ItemSize minimum size of an item to be flushed to disk (-o ext_item_size), default 512
+	// +optional
+	ItemSize *resource.Quantity `json:"itemSize,omitempty"`
+	// Threads number of IO threads (-o ext_threads), default 1
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Threads int32 `json:"threads,omitempty"`
+	// Volume defines where the extstore file lives
+	// +optional
+	Volume ExtstoreVolume `json:"volume,omitempty"`
+}
+
+// Auth struct for memcached authentication.
+// twemproxy can't authenticate against memcached, so the proxy can't be used together with it
+type Auth struct {
+	// +optional
+	Enable bool `json:"enable,omitempty"`
+	// Specifies the authentication mode.
+	// Valid values are:
+	// - "ASCII"(default): the ASCII protocol auth file (-Y);
+	// - "SASL": SASL PLAIN over the binary protocol (-S), memcached has to be built with --enable-sasl-pwdb;
+	// +optional
+	Mode AuthMode `json:"mode,omitempty"`
+	// SecretName of the Secret in the Memcached namespace holding the credentials, required when enabled
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+	// SecretKey of the credentials in the Secret, one username:password per line, default "auth"
+	// +optional
+	SecretKey string `json:"secretKey,omitempty"`
+}
+
+// Scaling struct for the scale down settings
+type Scaling struct {
+	// DrainPeriod is how long the departing pods keep running after they were taken out of the
+	// proxy pool and marked in status, so clients can move off them, default 30s
+	// +optional
+	DrainPeriod *metav1.Duration `json:"drainPeriod,omitempty"`
+	// MaxStepDown is how many pods a scale down removes at once, an integer or a percentage of
+	// the current replicas, default all of them
+	// +optional
+	MaxStepDown *intstr.IntOrString `json:"maxStepDown,omitempty"`
+	// StepInterval is the pause between two scale down steps, default 20s
+	// +optional
+	StepInterval *metav1.Duration `json:"stepInterval,omitempty"`
+	// StabilizationWindow is how long a lower size has to stay before the scale down starts,
+	// so a short dip doesn't throw away part of the keyspace, default 0
+	// +optional
+	StabilizationWindow *metav1.Duration `json:"stabilizationWindow,omitempty"`
+}
+
+// Stats struct for polling the memcached stats.
+// The stats command is a text protocol one, SASL and the binary protocol can't be polled
+type Stats struct {
+	// +optional
+	Enable bool `json:"enable,omitempty"`
+	// Interval between two polls, default 30s
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Thresholds that set the Degraded condition when crossed
+	// +optional
+	Thresholds StatsThresholds `json:"thresholds,omitempty"`
+}
+
+// StatsThresholds struct for the limits on the aggregated stats, unset ones are not checked
+type StatsThresholds struct {
+	// MaxEvictionsPerSecond is the eviction rate ceiling over all pods, e.g. "10" or "0.5"
+	// +optional
+	MaxEvictionsPerSecond *resource.Quantity `json:"maxEvictionsPerSecond,omitempty"`
+	// MinHitRatio is the lowest hit ratio in percent, over the gets between two polls
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	MinHitRatio *int32 `json:"minHitRatio,omitempty"`
+	// MaxMemoryUsage is the highest share of the cache in use, in percent
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	MaxMemoryUsage *int32 `json:"maxMemoryUsage,omitempty"`
+	// MaxConnections is the ceiling of open connections over all pods
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxConnections *int32 `json:"maxConnections,omitempty"`
+}
+
+// ServiceSpec struct for the Service exposure
+type ServiceSpec struct {
+	// Type of the Service, default ClusterIP
+	// +kubebuilder:validation:Enum=ClusterIP;NodePort;LoadBalancer
+	// +optional
+	Type corev1.ServiceType `json:"type,omitempty"`
+	// Annotations added to the Service, e.g. for the cloud load balancer
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// LoadBalancerSourceRanges restricts the clients of a LoadBalancer Service
+	// +optional
+	LoadBalancerSourceRanges []string `json:"loadBalancerSourceRanges,omitempty"`
+	// ExternalTrafficPolicy of a NodePort or LoadBalancer Service
+	// +kubebuilder:validation:Enum=Cluster;Local
+	// +optional
+	ExternalTrafficPolicy corev1.ServiceExternalTrafficPolicy `json:"externalTrafficPolicy,omitempty"`
+	// +kubebuilder:validation:Enum=Cluster;Local
+	// +optional
+	InternalTrafficPolicy *corev1.ServiceInternalTrafficPolicy `json:"internalTrafficPolicy,omitempty"`
+	// IPFamilies of the Service, two families make it dual-stack
+	// +kubebuilder:validation:MaxItems=2
+	// +optional
+	IPFamilies []corev1.IPFamily `json:"ipFamilies,omitempty"`
+	// +kubebuilder:validation:Enum=SingleStack;PreferDualStack;RequireDualStack
+	// +optional
+	IPFamilyPolicy *corev1.IPFamilyPolicy `json:"ipFamilyPolicy,omitempty"`
+	// Headless adds a headless twin of the Service named <service>-headless, for clients
+	// discovering the pods through DNS. The StatefulSet topology always has one
+	// +optional
+	Headless bool `json:"headless,omitempty"`
+	// UDP enables the memcached UDP port (-U) on the container port and exposes it,
+	// not supported by the proxy
+	// +optional
+	UDP bool `json:"udp,omitempty"`
+}
+
+// PodTemplate struct for the pod settings merged into the generated pod spec.
+// By default pods are spread across zones and prefer distinct nodes
+type PodTemplate struct {
+	// Labels added to the pods, the app.kubernetes.io labels set by the operator are rejected
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations added to the pods, the operator annotations take precedence
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// Affinity replaces the matching parts (node, pod, pod anti-affinity) of the default affinity
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// TopologySpreadConstraints replaces the default zone spread
+	// +optional
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+}
+
+// Probes struct for overriding the generated probes
+type Probes struct {
+	// +optional
+	Liveness *ProbeOverrides `json:"liveness,omitempty"`
+	// +optional
+	Readiness *ProbeOverrides `json:"readiness,omitempty"`
+	// +optional
+	Startup *ProbeOverrides `json:"startup,omitempty"`
+}
+
+// ProbeOverrides struct for the probe timing and thresholds, unset fields keep the operator default
+type ProbeOverrides struct {
+	// Disable removes the probe
+	// +optional
+	Disable bool `json:"disable,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	InitialDelaySeconds int32 `json:"initialDelaySeconds,omitempty"`
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	PeriodSeconds int32 `json:"periodSeconds,omitempty"`
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+	// SuccessThreshold has to be 1 for the liveness and startup probes
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	SuccessThreshold int32 `json:"successThreshold,omitempty"`
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+}
+
+// Monitoring struct for the Prometheus exporters
+type Monitoring struct {
+	// +optional
+	Enable bool `json:"enable,omitempty"`
+	// Parameter for setting image and tag for the memcached_exporter sidecar
+	// default 'quay.io/prometheus/memcached-exporter:v0.14.2'
+	// +optional
+	ExporterImage DockerImage `json:"exporterImage,omitempty"`
+	// Parameter for setting image and tag for the twemproxy stats exporter sidecar
+	// default 'zlodey23/twemproxy-exporter:0.1.0'
+	// +optional
+	ProxyExporterImage DockerImage `json:"proxyExporterImage,omitempty"`
+	// Resources defines CPU and memory for the exporter containers
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	// Interval between scrapes, the Prometheus default when empty
+	// +kubebuilder:validation:Pattern=`^(0|(([0-9]+)h)?(([0-9]+)m)?(([0-9]+)s)?(([0-9]+)ms)?)$`
+	// +optional
+	Interval string `json:"interval,omitempty"`
+	// Labels added to the ServiceMonitor and the PrometheusRule, to match the Prometheus selectors
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// TLS struct for serving memcached over TLS (-Z).
+// twemproxy doesn't speak TLS, so the proxy can't be used together with it
+type TLS struct {
+	// +optional
+	Enable bool `json:"enable,omitempty"`
+	// SecretName of the kubernetes.io/tls Secret holding tls.crt, tls.key and optionally ca.crt.
+	// Required unless certManager is set, the Certificate then writes into it, default <name>-tls
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+	// CertManager requests the certificate from cert-manager instead of using an existing Secret
+	// +optional
+	CertManager *CertManager `json:"certManager,omitempty"`
+	// VerifyClients requires clients to present a certificate signed by the ca.crt of the Secret
+	// +optional
+	VerifyClients bool `json:"verifyClients,omitempty"`
+}
+
+// CertManager struct for the cert-manager Certificate created by the operator
+type CertManager struct {
+	IssuerRef IssuerReference `json:"issuerRef"`
+	// Duration of the certificate, the cert-manager default when empty
+	// +optional
+	Duration *metav1.Duration `json:"duration,omitempty"`
+	// RenewBefore the expiry, the cert-manager default when empty
+	// +optional
+	RenewBefore *metav1.Duration `json:"renewBefore,omitempty"`
+}
+
+// IssuerReference struct for the cert-manager issuer signing the certificate
+type IssuerReference struct {
+	Name string `json:"name"`
+	// Kind of the issuer, Issuer or ClusterIssuer, default Issuer
+	// +optional
+	Kind string `json:"kind,omitempty"`
+	// Group of the issuer, default cert-manager.io
+	// +optional
+	Group string `json:"group,omitempty"`
+}
+
+// AuthMode
+// +kubebuilder:validation:Enum=ASCII;SASL
+type AuthMode string
+
+const (
+	// AuthModeASCII authenticates with the ASCII protocol auth file
+	AuthModeASCII AuthMode = "ASCII"
+
+	// AuthModeSASL authenticates with SASL PLAIN
+	AuthModeSASL AuthMode = "SASL"
+)
+
+// ExtstoreVolume struct for the volume holding the extstore file
+type ExtstoreVolume struct {
+	// Specifies the volume type.
+	// Valid values are:
+	// - "EmptyDir"(default): an emptyDir on the node disk, limited to Size plus one 64Mi page;
+	// - "PersistentVolumeClaim": a PersistentVolumeClaim per pod, created and deleted together with the pod;
+	// +optional
+	Type ExtstoreVolumeType `json:"type,omitempty"`
+	// StorageClassName of the PersistentVolumeClaim, the cluster default when empty
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+}
+
+// ExtstoreVolumeType
+// +kubebuilder:validation:Enum=EmptyDir;PersistentVolumeClaim
+type ExtstoreVolumeType string
+
+const (
+	// ExtstoreVolumeEmptyDir keeps the extstore file in an emptyDir
+	ExtstoreVolumeEmptyDir ExtstoreVolumeType = "EmptyDir"
+
+	// ExtstoreVolumePersistentVolumeClaim keeps the extstore file on a per pod PersistentVolumeClaim
+	ExtstoreVolumePersistentVolumeClaim ExtstoreVolumeType = "PersistentVolumeClaim"
+)
+
+// Protocol
+// +kubebuilder:validation:Enum=auto;ascii;binary
+type Protocol string
+
+const (
+	// ProtocolAuto negotiates the protocol per connection
+	ProtocolAuto Protocol = "auto"
+
+	// ProtocolASCII only accepts the text protocol
+	ProtocolASCII Protocol = "ascii"
+
+	// ProtocolBinary only accepts the binary protocol
+	ProtocolBinary Protocol = "binary"
+)
+
+// Topology
+// +kubebuilder:validation:Enum=Deployment;StatefulSet
+type Topology string
+
+const (
+	// TopologyDeployment runs Memcached as a Deployment
+	TopologyDeployment Topology = "Deployment"
+
+	// TopologyStatefulSet runs Memcached as a StatefulSet with stable pod identities
+	TopologyStatefulSet Topology = "StatefulSet"
+)
+
 // Proxy struct for enabling and configure Twemproxy
 type Proxy struct {
 	// +optional
@@ -95,6 +619,37 @@ type Proxy struct {
 	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
 	// +optional
 	Config ProxyConfig `json:"config,omitempty"`
+	// Probes overrides the timing and thresholds of the proxy probes
+	// +optional
+	Probes Probes `json:"probes,omitempty"`
+	// PodTemplate is merged into the generated proxy pod spec
+	// +optional
+	PodTemplate PodTemplate `json:"podTemplate,omitempty"`
+	// MaxUnavailable proxy pods during voluntary disruptions like node drains, an integer or
+	// a percentage of Replicas, default 1
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+	// Service defines how the proxy Service is exposed
+	// +optional
+	Service ServiceSpec `json:"service,omitempty"`
+	// RampUp adds new memcached pods to the generated server list at a low weight and raises it
+	// step by step, so a scale up doesn't remap a large part of the keys to cold servers at once
+	// +optional
+	RampUp RampUp `json:"rampUp,omitempty"`
+}
+
+// RampUp struct for the weighted ramp-up of new proxy backends
+type RampUp struct {
+	// +optional
+	Enable bool `json:"enable,omitempty"`
+	// Weights a new backend goes through, in percent of the full weight, default [10, 25, 50]
+	// +kubebuilder:validation:MaxItems=10
+	// +optional
+	Weights []int32 `json:"weights,omitempty"`
+	// StepInterval is how long a backend stays at each weight, counted from the time the pod
+	// became ready, default 1m
+	// +optional
+	StepInterval *metav1.Duration `json:"stepInterval,omitempty"`
 }
 
 // ProxyConfig struct used for describe parameters of Twemproxy
@@ -121,12 +676,13 @@ type ProxyConfig struct {
 	// +optional
 	Timeout int64 `json:"timeout"`
 	// Servers list of server address, port and weight (name:port:weight or ip:port:weight), default []
+	// When empty, the list is generated from the ready Memcached pods and kept in sync with them
 	// +optional
 	Servers []string `json:"servers"`
 }
 
 // ===============================================================================
-// Condition
+// Condition types of the metav1.Condition in MemcachedStatus.Conditions
 type MemcachedConditionType string
 
 const (
@@ -136,36 +692,177 @@ const (
 	MemcachedScalingUp   MemcachedConditionType = "ScalingUp"
 	MemcachedScalingDown MemcachedConditionType = "ScalingDown"
 	MemcachedUpdating    MemcachedConditionType = "Updating"
+	MemcachedProxy       MemcachedConditionType = "ProxyEnabled"
 )
 
-type MemcachedCondition struct {
-	Type               MemcachedConditionType `json:"type"`
-	Status             corev1.ConditionStatus `json:"status"`
-	Reason             string                 `json:"reason"`
-	Message            string                 `json:"message"`
-	LastTransitionTime metav1.Time            `json:"lastTransitionTime,omitempty"`
+// ScalingStatus reports the progress of a step-wise scale down
+type ScalingStatus struct {
+	// TargetReplicas is the size the scale down works towards
+	TargetReplicas int32 `json:"targetReplicas"`
+	// StepReplicas is the size the current step goes down to
+	StepReplicas int32 `json:"stepReplicas"`
+	// Since is when the scale down was first seen, the stabilization window starts there
+	Since metav1.Time `json:"since"`
+	// LastStepTime is when the last step was applied
+	// +optional
+	LastStepTime *metav1.Time `json:"lastStepTime,omitempty"`
+}
+
+// ProxyStatus defines the observed state of the Twemproxy tier
+type ProxyStatus struct {
+	// Replicas is the desired number of Twemproxy instances
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+	// ReadyReplicas is the number of Twemproxy instances ready to serve traffic
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+	// AvailableReplicas is the number of Twemproxy instances ready for at least minReadySeconds
+	// +optional
+	AvailableReplicas int32 `json:"availableReplicas,omitempty"`
+	// Ready is ReadyReplicas/Replicas, for display
+	// +optional
+	Ready string `json:"ready,omitempty"`
+}
+
+// EndpointStatus describes a memcached pod clients can connect to
+type EndpointStatus struct {
+	// Pod is the name of the pod
+	Pod string `json:"pod"`
+	// Address is the host:port of the pod, the stable DNS name with the StatefulSet topology
+	// +optional
+	Address string `json:"address,omitempty"`
+	// Ready tells whether the pod is ready to serve traffic
+	Ready bool `json:"ready"`
+	// Version is the memcached version the pod reports, empty when it couldn't be queried
+	// +optional
+	Version string `json:"version,omitempty"`
+}
+
+// ImagesStatus reports the images resolved from the spec and the defaults
+type ImagesStatus struct {
+	// +optional
+	Memcached string `json:"memcached,omitempty"`
+	// +optional
+	Proxy string `json:"proxy,omitempty"`
+	// +optional
+	Exporter string `json:"exporter,omitempty"`
+	// +optional
+	ProxyExporter string `json:"proxyExporter,omitempty"`
+}
+
+// StatsStatus reports the stats of the memcached pods, summed over the pods that answered
+type StatsStatus struct {
+	// Pods is the number of pods that answered the last poll
+	Pods int32 `json:"pods"`
+	// PolledPods are the names of the pods that answered the last poll, the rates are only
+	// computed between two polls of the same pods
+	// +optional
+	PolledPods []string `json:"polledPods,omitempty"`
+	// HitRatio is get_hits over all gets since the previous poll, e.g. "93.5%"
+	// +optional
+	HitRatio string `json:"hitRatio,omitempty"`
+	// GetHits is the get_hits counter, the hit ratio is computed from its increase
+	GetHits int64 `json:"getHits"`
+	// GetMisses is the get_misses counter, the hit ratio is computed from its increase
+	GetMisses int64 `json:"getMisses"`
+	// EvictionsPerSecond is the eviction rate since the previous poll, e.g. "1.25"
+	// +optional
+	EvictionsPerSecond string `json:"evictionsPerSecond,omitempty"`
+	// Evictions is the evictions counter, the rate is computed from its increase
+	Evictions int64 `json:"evictions"`
+	// Items is the number of items stored
+	Items int64 `json:"items"`
+	// Bytes is the memory used by the items
+	Bytes int64 `json:"bytes"`
+	// LimitBytes is the cache size of the pods
+	LimitBytes int64 `json:"limitBytes"`
+	// Memory is Bytes over LimitBytes, for display, e.g. "12.5Mi/64Mi"
+	// +optional
+	Memory string `json:"memory,omitempty"`
+	// Connections is the number of open client connections
+	Connections int32 `json:"connections"`
+	// LastPollTime is when the stats were polled
+	LastPollTime metav1.Time `json:"lastPollTime"`
+	// ThresholdsExceeded lists the spec.stats.thresholds crossed at the last poll
+	// +optional
+	ThresholdsExceeded []string `json:"thresholdsExceeded,omitempty"`
 }
 
 // MemcachedStatus defines the observed state of Memcached
 type MemcachedStatus struct {
-	// Size defines the number of Memcached instances
+	// Size is the number of memcached pods, the replicas reported by the scale subresource
 	Size int32 `json:"size,omitempty"`
-	// Selector is the label selector used to find all pods.
+	// Selector is the label selector of the memcached pods, the HorizontalPodAutoscaler finds
+	// the pods of the scale subresource with it
 	Selector string `json:"selector,omitempty"`
+	// Replicas is the number of memcached pods
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+	// ReadyReplicas is the number of memcached pods ready to serve traffic
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+	// AvailableReplicas is the number of memcached pods ready for at least minReadySeconds
+	// +optional
+	AvailableReplicas int32 `json:"availableReplicas,omitempty"`
+	// Ready is ReadyReplicas/Size, for display
+	// +optional
+	Ready string `json:"ready,omitempty"`
 	// Represents the observations of a Memcached's current state.
-	Conditions []MemcachedCondition `json:"conditions,omitempty"`
+	// +listType=map
+	// +listMapKey=type
+	// +patchStrategy=merge
+	// +patchMergeKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
 	// Last known progress state
 	// +optional
 	OperatorProgress ProgressState `json:"operatorProgress,omitempty"`
 	// +optional
 	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Proxy reports the replicas of the Twemproxy tier
+	// +optional
+	Proxy ProxyStatus `json:"proxy,omitempty"`
+	// MemoryLimit is the cache size given to memcached with --memory-limit
+	// +optional
+	MemoryLimit *resource.Quantity `json:"memoryLimit,omitempty"`
+	// DecommissioningPods lists the pods being drained before a scale down, clients shouldn't use them
+	// +optional
+	DecommissioningPods []string `json:"decommissioningPods,omitempty"`
+	// Scaling reports the progress of a scale down, unset when none is going on
+	// +optional
+	Scaling *ScalingStatus `json:"scaling,omitempty"`
+	// Endpoints lists the memcached pods with their address and version
+	// +optional
+	Endpoints []EndpointStatus `json:"endpoints,omitempty"`
+	// ConnectionString is the address clients use, the proxy Service when the proxy is enabled
+	// +optional
+	ConnectionString string `json:"connectionString,omitempty"`
+	// Images are the images the pods run
+	// +optional
+	Images ImagesStatus `json:"images,omitempty"`
+	// Stats are the live stats of the pods, unset unless spec.stats is enabled
+	// +optional
+	Stats *StatsStatus `json:"stats,omitempty"`
+	// OptionalResources lists the kinds of the optional CRDs (cert-manager, prometheus-operator) the
+	// operator created an object of, the API server is only asked about the other kinds while enabled
+	// +optional
+	OptionalResources []string `json:"optionalResources,omitempty"`
 }
 
 // ===============================================================================
 // Memcached is the Schema for the memcacheds API
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
-// +kubebuilder:printcolumn:name="Size",type=integer,JSONPath=`.spec.size`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.ready`
+// +kubebuilder:printcolumn:name="Proxy",type=string,JSONPath=`.status.proxy.ready`
+// +kubebuilder:printcolumn:name="Progress",type=string,JSONPath=`.status.operatorProgress`
+// +kubebuilder:printcolumn:name="Size",type=integer,JSONPath=`.spec.size`,priority=1
+// +kubebuilder:printcolumn:name="Hit Ratio",type=string,JSONPath=`.status.stats.hitRatio`,priority=1
+// +kubebuilder:printcolumn:name="Evictions/s",type=string,JSONPath=`.status.stats.evictionsPerSecond`,priority=1
+// +kubebuilder:printcolumn:name="Items",type=integer,JSONPath=`.status.stats.items`,priority=1
+// +kubebuilder:printcolumn:name="Memory",type=string,JSONPath=`.status.stats.memory`,priority=1
+// +kubebuilder:printcolumn:name="Connections",type=integer,JSONPath=`.status.stats.connections`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 // +kubebuilder:subresource:scale:specpath=.spec.size,statuspath=.status.size,selectorpath=.status.selector
 type Memcached struct {
 	metav1.TypeMeta   `json:",inline"`
@@ -190,23 +887,96 @@ func init() {
 }
 
 // ===============================================================================
-func (m *Memcached) GetCondition(conditionType MemcachedConditionType) (MemcachedCondition, bool) {
-	for _, condition := range m.Status.Conditions {
-		if condition.Type == conditionType {
-			return condition, true
-		}
+func (m *Memcached) GetCondition(conditionType MemcachedConditionType) (metav1.Condition, bool) {
+	condition := meta.FindStatusCondition(m.Status.Conditions, string(conditionType))
+	if condition == nil {
+		return metav1.Condition{}, false
 	}
 
-	return MemcachedCondition{}, false
+	return *condition, true
 }
 
 func (status *MemcachedStatus) GetConditionStatus(
 	conditionType MemcachedConditionType,
-) corev1.ConditionStatus {
-	for _, condition := range status.Conditions {
-		if condition.Type == conditionType {
-			return condition.Status
-		}
+) metav1.ConditionStatus {
+	condition := meta.FindStatusCondition(status.Conditions, string(conditionType))
+	if condition == nil {
+		return metav1.ConditionUnknown
+	}
+	return condition.Status
+}
+
+// SetCondition adds or replaces the condition of the same type, the transition time only moves
+// when the status changes. It reports whether anything was changed.
+func (status *MemcachedStatus) SetCondition(condition metav1.Condition) bool {
+	return meta.SetStatusCondition(&status.Conditions, condition)
+}
+
+// DrainPeriod returns how long departing pods are drained before they are removed
+func (s *MemcachedSpec) DrainPeriod() time.Duration {
+	if s.Scaling.DrainPeriod == nil {
+		return DefaultDrainPeriod
+	}
+	return s.Scaling.DrainPeriod.Duration
+}
+
+// StepInterval returns the pause between two scale down steps
+func (s *MemcachedSpec) StepInterval() time.Duration {
+	if s.Scaling.StepInterval == nil {
+		return DefaultStepInterval
+	}
+	return s.Scaling.StepInterval.Duration
+}
+
+// StatsInterval returns the pause between two polls of the memcached stats
+func (s *MemcachedSpec) StatsInterval() time.Duration {
+	if s.Stats.Interval == nil {
+		return DefaultStatsInterval
 	}
-	return corev1.ConditionUnknown
+	return s.Stats.Interval.Duration
+}
+
+// RampUpWeights returns the ramp-up weights of a new proxy backend
+func (p *Proxy) RampUpWeights() []int32 {
+	if len(p.RampUp.Weights) == 0 {
+		return DefaultRampUpWeights
+	}
+	return p.RampUp.Weights
+}
+
+// RampUpStepInterval returns how long a new proxy backend stays at each ramp-up weight
+func (p *Proxy) RampUpStepInterval() time.Duration {
+	if p.RampUp.StepInterval == nil {
+		return DefaultRampUpStepInterval
+	}
+	return p.RampUp.StepInterval.Duration
+}
+
+// MemoryBase returns the container memory in bytes the cache is derived from, 0 when it is not set
+func (s *MemcachedSpec) MemoryBase() int64 {
+	if s.Memory.Source == MemorySourceRequests {
+		return s.Resources.Requests.Memory().Value()
+	}
+	return s.Resources.Limits.Memory().Value()
+}
+
+// CacheSize returns the cache size in bytes given to memcached with --memory-limit
+func (s *MemcachedSpec) CacheSize() int64 {
+	if s.Memory.CacheSize != nil {
+		return s.Memory.CacheSize.Value()
+	}
+
+	base := s.MemoryBase()
+	if base == 0 {
+		return DefaultCacheSize
+	}
+
+	headroom := DefaultMemoryHeadroom
+	if s.Memory.HeadroomPercent != nil {
+		headroom = base * int64(*s.Memory.HeadroomPercent) / 100
+	} else if s.Memory.Headroom != nil {
+		headroom = s.Memory.Headroom.Value()
+	}
+
+	return base - headroom
 }
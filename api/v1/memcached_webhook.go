@@ -1,9 +1,17 @@
 package v1
 
 import (
+	"net"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -33,6 +41,39 @@ func (r *Memcached) Default() {
 	if r.Spec.Verbose == "" {
 		r.Spec.Verbose = Enabled
 	}
+
+	if r.Spec.Topology == "" {
+		r.Spec.Topology = TopologyDeployment
+	}
+
+	if r.Spec.ContainerPort == 0 {
+		r.Spec.ContainerPort = DefaultPort
+	}
+
+	if r.Spec.Proxy.Enable && r.Spec.Proxy.Replicas == 0 {
+		r.Spec.Proxy.Replicas = 1
+	}
+
+	if r.Spec.TLS.Enable && r.Spec.TLS.CertManager != nil {
+		if r.Spec.TLS.SecretName == "" {
+			r.Spec.TLS.SecretName = r.Name + "-tls"
+		}
+		if r.Spec.TLS.CertManager.IssuerRef.Kind == "" {
+			r.Spec.TLS.CertManager.IssuerRef.Kind = "Issuer"
+		}
+		if r.Spec.TLS.CertManager.IssuerRef.Group == "" {
+			r.Spec.TLS.CertManager.IssuerRef.Group = "cert-manager.io"
+		}
+	}
+
+	if r.Spec.Auth.Enable {
+		if r.Spec.Auth.Mode == "" {
+			r.Spec.Auth.Mode = AuthModeASCII
+		}
+		if r.Spec.Auth.SecretKey == "" {
+			r.Spec.Auth.SecretKey = DefaultAuthSecretKey
+		}
+	}
 }
 
 // +kubebuilder:webhook:path=/validate-cache-bsod-io-v1-memcached,mutating=false,failurePolicy=fail,sideEffects=None,groups=cache.bsod.io,resources=memcacheds,verbs=create;update,versions=v1,name=vmemcached.kb.io,admissionReviewVersions=v1
@@ -44,14 +85,14 @@ var _ webhook.Validator = &Memcached{}
 func (r *Memcached) ValidateCreate() (admission.Warnings, error) {
 	memcachedlog.Info("validate create", "name", r.Name)
 
-	return nil, r.validateMemcached()
+	return r.memcachedWarnings(), r.validateMemcached()
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
 func (r *Memcached) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
 	memcachedlog.Info("validate update", "name", r.Name)
 
-	return nil, r.validateMemcached()
+	return r.memcachedWarnings(), r.validateMemcached()
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type
@@ -69,6 +110,22 @@ func (r *Memcached) validateMemcached() error {
 		allErrs = append(allErrs, err)
 	}
 
+	allErrs = append(allErrs, r.validateMemcachedMemoryPolicy()...)
+	allErrs = append(allErrs, r.validateMemcachedTuning()...)
+	allErrs = append(allErrs, r.validateMemcachedExtstore()...)
+	allErrs = append(allErrs, r.validateMemcachedAuth()...)
+	allErrs = append(allErrs, r.validateMemcachedTLS()...)
+	allErrs = append(allErrs, validateProbes(field.NewPath("probes"), r.Spec.Probes)...)
+	allErrs = append(allErrs, validateProbes(field.NewPath("proxy").Child("probes"), r.Spec.Proxy.Probes)...)
+	allErrs = append(allErrs, validateMaxUnavailable(field.NewPath("maxUnavailable"), r.Spec.MaxUnavailable)...)
+	allErrs = append(allErrs, validateMaxUnavailable(field.NewPath("proxy").Child("maxUnavailable"), r.Spec.Proxy.MaxUnavailable)...)
+	allErrs = append(allErrs, r.validateMemcachedService()...)
+	allErrs = append(allErrs, r.validateMemcachedScaling()...)
+	allErrs = append(allErrs, r.validateProxyRampUp()...)
+	allErrs = append(allErrs, r.validateMemcachedStats()...)
+	allErrs = append(allErrs, validatePodTemplate(field.NewPath("podTemplate"), r.Spec.PodTemplate)...)
+	allErrs = append(allErrs, validatePodTemplate(field.NewPath("proxy").Child("podTemplate"), r.Spec.Proxy.PodTemplate)...)
+
 	if len(allErrs) == 0 {
 		return nil
 	}
@@ -94,3 +151,562 @@ func (r *Memcached) validateMemcachedMemoryLimit() *field.Error {
 	}
 	return nil
 }
+
+func (r *Memcached) memcachedWarnings() admission.Warnings {
+	var warnings admission.Warnings
+
+	if r.Spec.Memory.CacheSize == nil && r.Spec.MemoryBase() == 0 {
+		warnings = append(warnings,
+			"no container memory to derive the cache size from, memcached uses its default of 64Mi")
+	}
+
+	if r.Spec.Auth.Enable && r.Spec.Proxy.Enable {
+		warnings = append(warnings,
+			"twemproxy can't authenticate against memcached, the proxy won't be able to reach the pool with auth enabled")
+	}
+
+	if r.Spec.TLS.Enable && r.Spec.Proxy.Enable {
+		warnings = append(warnings,
+			"twemproxy doesn't speak TLS, the proxy won't be able to reach the pool with TLS enabled")
+	}
+
+	if r.Spec.Monitoring.Enable && r.Spec.Auth.Enable {
+		warnings = append(warnings,
+			"memcached_exporter can't authenticate against memcached, the memcached metrics will only report memcached_up 0")
+	}
+
+	if r.Spec.Proxy.RampUp.Enable && len(r.Spec.Proxy.Config.Servers) != 0 {
+		warnings = append(warnings,
+			"proxy.rampUp only applies to the generated server list, it is ignored with proxy.config.servers")
+	}
+
+	return warnings
+}
+
+func (r *Memcached) validateMemcachedMemoryPolicy() field.ErrorList {
+	memcachedlog.Info("validate memory policy", "name", r.Name)
+
+	var allErrs field.ErrorList
+	memory := r.Spec.Memory
+	memoryPath := field.NewPath("memory")
+
+	if memory.HeadroomPercent != nil && memory.Headroom != nil {
+		allErrs = append(allErrs, field.Forbidden(
+			memoryPath.Child("headroom"),
+			"can't be used together with headroomPercent",
+		))
+	}
+
+	if memory.Source == MemorySourceRequests && r.Spec.Resources.Requests.Memory().IsZero() {
+		allErrs = append(allErrs, field.Required(
+			field.NewPath("resources").Child("requests").Child("memory"),
+			"required when memory.source is Requests",
+		))
+	}
+
+	memLimit := r.Spec.Resources.Limits.Memory().Value()
+	if memory.CacheSize != nil {
+		if memory.CacheSize.Value() <= 0 {
+			allErrs = append(allErrs, field.Invalid(
+				memoryPath.Child("cacheSize"),
+				memory.CacheSize.String(),
+				"must be positive",
+			))
+		} else if memLimit != 0 && memory.CacheSize.Value() > memLimit {
+			allErrs = append(allErrs, field.Invalid(
+				memoryPath.Child("cacheSize"),
+				memory.CacheSize.String(),
+				"must fit in resources.limits.memory",
+			))
+		}
+		return allErrs
+	}
+
+	if r.Spec.MemoryBase() != 0 && r.Spec.CacheSize() < 1024*1024 {
+		allErrs = append(allErrs, field.Invalid(
+			memoryPath,
+			r.Spec.CacheSize(),
+			"the headroom leaves less than 1Mi for the cache",
+		))
+	}
+
+	return allErrs
+}
+
+func (r *Memcached) validateMemcachedTuning() field.ErrorList {
+	memcachedlog.Info("validate tuning", "name", r.Name)
+
+	var allErrs field.ErrorList
+	tuning := r.Spec.Tuning
+	tuningPath := field.NewPath("tuning")
+
+	if tuning.MaxItemSize != nil {
+		minItemSize := resource.MustParse("1Ki")
+		maxItemSize := resource.MustParse("1Gi")
+		if tuning.MaxItemSize.Cmp(minItemSize) < 0 || tuning.MaxItemSize.Cmp(maxItemSize) > 0 {
+			allErrs = append(allErrs, field.Invalid(
+				tuningPath.Child("maxItemSize"),
+				tuning.MaxItemSize.String(),
+				"must be between 1Ki and 1Gi",
+			))
+		}
+
+		// memcached refuses to start when an item can take more than half of the cache
+		if tuning.MaxItemSize.Value() > r.Spec.CacheSize()/2 {
+			allErrs = append(allErrs, field.Invalid(
+				tuningPath.Child("maxItemSize"),
+				tuning.MaxItemSize.String(),
+				"must be at most half of the cache size",
+			))
+		}
+	}
+
+	if tuning.GrowthFactor != "" {
+		factor, err := strconv.ParseFloat(tuning.GrowthFactor, 64)
+		if err != nil || factor <= 1 {
+			allErrs = append(allErrs, field.Invalid(
+				tuningPath.Child("growthFactor"),
+				tuning.GrowthFactor,
+				"must be a decimal number greater than 1",
+			))
+		}
+	}
+
+	if tuning.LRUMaintainer != nil && !*tuning.LRUMaintainer {
+		if tuning.HotLRUPercent != 0 {
+			allErrs = append(allErrs, field.Forbidden(
+				tuningPath.Child("hotLRUPercent"),
+				"requires lruMaintainer",
+			))
+		}
+		if tuning.WarmLRUPercent != 0 {
+			allErrs = append(allErrs, field.Forbidden(
+				tuningPath.Child("warmLRUPercent"),
+				"requires lruMaintainer",
+			))
+		}
+	}
+
+	// the memcached defaults are 20 for hot and 40 for warm
+	hot, warm := tuning.HotLRUPercent, tuning.WarmLRUPercent
+	if hot == 0 {
+		hot = 20
+	}
+	if warm == 0 {
+		warm = 40
+	}
+	if hot+warm > 80 {
+		allErrs = append(allErrs, field.Invalid(
+			tuningPath.Child("warmLRUPercent"),
+			tuning.WarmLRUPercent,
+			"hotLRUPercent and warmLRUPercent can't take more than 80 together",
+		))
+	}
+
+	return allErrs
+}
+
+func (r *Memcached) validateMemcachedExtstore() field.ErrorList {
+	memcachedlog.Info("validate extstore", "name", r.Name)
+
+	var allErrs field.ErrorList
+	extstore := r.Spec.Extstore
+	extstorePath := field.NewPath("extstore")
+
+	if !extstore.Enable {
+		return allErrs
+	}
+
+	if extstore.Size.IsZero() {
+		allErrs = append(allErrs, field.Required(
+			extstorePath.Child("size"),
+			"required when extstore is enabled",
+		))
+	} else if extstore.Size.Value() < ExtstorePageSize {
+		allErrs = append(allErrs, field.Invalid(
+			extstorePath.Child("size"),
+			extstore.Size.String(),
+			"must be at least 64Mi",
+		))
+	}
+
+	writeBufferSize := DefaultExtstoreWriteBufferSize
+	if extstore.WriteBufferSize != nil {
+		writeBufferSize = extstore.WriteBufferSize.Value()
+		if writeBufferSize < 1024*1024 || writeBufferSize >= ExtstorePageSize {
+			allErrs = append(allErrs, field.Invalid(
+				extstorePath.Child("writeBufferSize"),
+				extstore.WriteBufferSize.String(),
+				"must be at least 1Mi and below 64Mi",
+			))
+		}
+	}
+
+	// the write buffers are allocated next to the cache, they have to fit in the headroom
+	threads := int64(extstore.Threads)
+	if threads == 0 {
+		threads = 1
+	}
+	memLimit := r.Spec.Resources.Limits.Memory().Value()
+	if memLimit != 0 && r.Spec.CacheSize()+writeBufferSize*threads > memLimit {
+		allErrs = append(allErrs, field.Invalid(
+			extstorePath.Child("writeBufferSize"),
+			writeBufferSize*threads,
+			"the write buffers of all threads don't fit in resources.limits.memory next to the cache",
+		))
+	}
+
+	if extstore.ItemSize != nil {
+		maxItemSize := resource.MustParse("1Mi")
+		if r.Spec.Tuning.MaxItemSize != nil {
+			maxItemSize = *r.Spec.Tuning.MaxItemSize
+		}
+		if extstore.ItemSize.Value() <= 0 || extstore.ItemSize.Cmp(maxItemSize) > 0 {
+			allErrs = append(allErrs, field.Invalid(
+				extstorePath.Child("itemSize"),
+				extstore.ItemSize.String(),
+				"must be positive and at most the max item size",
+			))
+		}
+	}
+
+	// extstore flushes items from the LRU tail, it needs the LRU maintainer
+	if r.Spec.Tuning.LRUMaintainer != nil && !*r.Spec.Tuning.LRUMaintainer {
+		allErrs = append(allErrs, field.Forbidden(
+			field.NewPath("tuning").Child("lruMaintainer"),
+			"can't be disabled when extstore is enabled",
+		))
+	}
+
+	if extstore.Volume.Type != ExtstoreVolumePersistentVolumeClaim && extstore.Volume.StorageClassName != nil {
+		allErrs = append(allErrs, field.Forbidden(
+			extstorePath.Child("volume").Child("storageClassName"),
+			"only used with the PersistentVolumeClaim volume type",
+		))
+	}
+
+	return allErrs
+}
+
+func (r *Memcached) validateMemcachedAuth() field.ErrorList {
+	memcachedlog.Info("validate auth", "name", r.Name)
+
+	var allErrs field.ErrorList
+	auth := r.Spec.Auth
+	authPath := field.NewPath("auth")
+
+	if !auth.Enable {
+		return allErrs
+	}
+
+	if auth.SecretName == "" {
+		allErrs = append(allErrs, field.Required(
+			authPath.Child("secretName"),
+			"required when auth is enabled",
+		))
+	}
+
+	// SASL only exists in the binary protocol and the auth file only in the ASCII one
+	protocolPath := field.NewPath("tuning").Child("protocol")
+	switch {
+	case auth.Mode == AuthModeSASL && r.Spec.Tuning.Protocol == ProtocolASCII:
+		allErrs = append(allErrs, field.Invalid(
+			protocolPath,
+			r.Spec.Tuning.Protocol,
+			"SASL requires the binary protocol",
+		))
+	case auth.Mode != AuthModeSASL && r.Spec.Tuning.Protocol == ProtocolBinary:
+		allErrs = append(allErrs, field.Invalid(
+			protocolPath,
+			r.Spec.Tuning.Protocol,
+			"the ASCII auth file requires the ASCII protocol",
+		))
+	}
+
+	return allErrs
+}
+
+func (r *Memcached) validateMemcachedTLS() field.ErrorList {
+	memcachedlog.Info("validate tls", "name", r.Name)
+
+	var allErrs field.ErrorList
+	tls := r.Spec.TLS
+	tlsPath := field.NewPath("tls")
+
+	if !tls.Enable {
+		return allErrs
+	}
+
+	if tls.CertManager == nil {
+		if tls.SecretName == "" {
+			allErrs = append(allErrs, field.Required(
+				tlsPath.Child("secretName"),
+				"required when TLS is enabled without certManager",
+			))
+		}
+		return allErrs
+	}
+
+	if tls.CertManager.IssuerRef.Name == "" {
+		allErrs = append(allErrs, field.Required(
+			tlsPath.Child("certManager").Child("issuerRef").Child("name"),
+			"required when certManager is set",
+		))
+	}
+
+	return allErrs
+}
+
+func validateProbes(probesPath *field.Path, probes Probes) field.ErrorList {
+	var allErrs field.ErrorList
+
+	// the kubelet only accepts a success threshold of 1 for these two
+	if probes.Liveness != nil && probes.Liveness.SuccessThreshold > 1 {
+		allErrs = append(allErrs, field.Invalid(
+			probesPath.Child("liveness").Child("successThreshold"),
+			probes.Liveness.SuccessThreshold,
+			"must be 1",
+		))
+	}
+	if probes.Startup != nil && probes.Startup.SuccessThreshold > 1 {
+		allErrs = append(allErrs, field.Invalid(
+			probesPath.Child("startup").Child("successThreshold"),
+			probes.Startup.SuccessThreshold,
+			"must be 1",
+		))
+	}
+
+	return allErrs
+}
+
+// operatorPodLabels are set by the operator on every pod, the selector and the cache rely on them
+var operatorPodLabels = []string{
+	"app.kubernetes.io/name",
+	"app.kubernetes.io/instance",
+	"app.kubernetes.io/version",
+	"app.kubernetes.io/part-of",
+	"app.kubernetes.io/created-by",
+	"app.kubernetes.io/managed-by",
+}
+
+func validatePodTemplate(podTemplatePath *field.Path, podTemplate PodTemplate) field.ErrorList {
+	var allErrs field.ErrorList
+
+	// the operator labels would win the merge, the value would be dropped without a word
+	for _, label := range operatorPodLabels {
+		if value, found := podTemplate.Labels[label]; found {
+			allErrs = append(allErrs, field.Invalid(
+				podTemplatePath.Child("labels").Key(label),
+				value,
+				"is set by the operator",
+			))
+		}
+	}
+
+	return allErrs
+}
+
+func validateMaxUnavailable(maxUnavailablePath *field.Path, maxUnavailable *intstr.IntOrString) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if maxUnavailable == nil {
+		return allErrs
+	}
+
+	// 0 would block node drains for good
+	if maxUnavailable.Type == intstr.Int {
+		if maxUnavailable.IntVal < 1 {
+			allErrs = append(allErrs, field.Invalid(
+				maxUnavailablePath,
+				maxUnavailable.String(),
+				"must be at least 1",
+			))
+		}
+		return allErrs
+	}
+
+	percent, err := strconv.Atoi(strings.TrimSuffix(maxUnavailable.StrVal, "%"))
+	if !strings.HasSuffix(maxUnavailable.StrVal, "%") || err != nil || percent < 1 || percent > 100 {
+		allErrs = append(allErrs, field.Invalid(
+			maxUnavailablePath,
+			maxUnavailable.String(),
+			"must be an integer or a percentage between 1% and 100%",
+		))
+	}
+
+	return allErrs
+}
+
+func (r *Memcached) validateMemcachedService() field.ErrorList {
+	memcachedlog.Info("validate service", "name", r.Name)
+
+	servicePath := field.NewPath("service")
+	allErrs := validateServiceSpec(servicePath, r.Spec.Service)
+
+	if r.Spec.Service.UDP {
+		// memcached only serves TLS and authentication over TCP
+		if r.Spec.TLS.Enable {
+			allErrs = append(allErrs, field.Forbidden(servicePath.Child("udp"), "can't be used together with TLS"))
+		}
+		if r.Spec.Auth.Enable {
+			allErrs = append(allErrs, field.Forbidden(servicePath.Child("udp"), "can't be used together with auth"))
+		}
+	}
+
+	proxyServicePath := field.NewPath("proxy").Child("service")
+	allErrs = append(allErrs, validateServiceSpec(proxyServicePath, r.Spec.Proxy.Service)...)
+
+	if r.Spec.Proxy.Service.UDP {
+		allErrs = append(allErrs, field.Forbidden(proxyServicePath.Child("udp"), "twemproxy doesn't serve memcached over UDP"))
+	}
+
+	return allErrs
+}
+
+func validateServiceSpec(servicePath *field.Path, service ServiceSpec) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if len(service.LoadBalancerSourceRanges) != 0 {
+		if service.Type != corev1.ServiceTypeLoadBalancer {
+			allErrs = append(allErrs, field.Forbidden(
+				servicePath.Child("loadBalancerSourceRanges"),
+				"only used with the LoadBalancer type",
+			))
+		}
+		for idx, cidr := range service.LoadBalancerSourceRanges {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				allErrs = append(allErrs, field.Invalid(
+					servicePath.Child("loadBalancerSourceRanges").Index(idx),
+					cidr,
+					"must be a CIDR",
+				))
+			}
+		}
+	}
+
+	if service.ExternalTrafficPolicy != "" &&
+		service.Type != corev1.ServiceTypeNodePort && service.Type != corev1.ServiceTypeLoadBalancer {
+		allErrs = append(allErrs, field.Forbidden(
+			servicePath.Child("externalTrafficPolicy"),
+			"only used with the NodePort and LoadBalancer types",
+		))
+	}
+
+	if len(service.IPFamilies) == 2 {
+		if service.IPFamilies[0] == service.IPFamilies[1] {
+			allErrs = append(allErrs, field.Duplicate(
+				servicePath.Child("ipFamilies").Index(1),
+				service.IPFamilies[1],
+			))
+		}
+		if service.IPFamilyPolicy == nil {
+			allErrs = append(allErrs, field.Required(
+				servicePath.Child("ipFamilyPolicy"),
+				"two ipFamilies require PreferDualStack or RequireDualStack",
+			))
+		} else if *service.IPFamilyPolicy == corev1.IPFamilyPolicySingleStack {
+			allErrs = append(allErrs, field.Invalid(
+				servicePath.Child("ipFamilyPolicy"),
+				*service.IPFamilyPolicy,
+				"two ipFamilies require PreferDualStack or RequireDualStack",
+			))
+		}
+	}
+
+	return allErrs
+}
+
+func (r *Memcached) validateMemcachedScaling() field.ErrorList {
+	memcachedlog.Info("validate scaling", "name", r.Name)
+
+	scalingPath := field.NewPath("scaling")
+	// A step of 0 pods would never finish, the bounds are the same as maxUnavailable
+	allErrs := validateMaxUnavailable(scalingPath.Child("maxStepDown"), r.Spec.Scaling.MaxStepDown)
+
+	durations := []struct {
+		name     string
+		duration *metav1.Duration
+	}{
+		{"drainPeriod", r.Spec.Scaling.DrainPeriod},
+		{"stepInterval", r.Spec.Scaling.StepInterval},
+		{"stabilizationWindow", r.Spec.Scaling.StabilizationWindow},
+	}
+	for _, d := range durations {
+		if d.duration != nil && d.duration.Duration < 0 {
+			allErrs = append(allErrs, field.Invalid(
+				scalingPath.Child(d.name),
+				d.duration.Duration.String(),
+				"must not be negative",
+			))
+		}
+	}
+
+	return allErrs
+}
+
+func (r *Memcached) validateProxyRampUp() field.ErrorList {
+	memcachedlog.Info("validate proxy ramp-up", "name", r.Name)
+
+	var allErrs field.ErrorList
+	rampUp := r.Spec.Proxy.RampUp
+	rampUpPath := field.NewPath("proxy").Child("rampUp")
+
+	// The weights are percentages of the full weight, each step has to raise it
+	previous := int32(0)
+	for idx, weight := range rampUp.Weights {
+		if weight <= previous || weight >= 100 {
+			allErrs = append(allErrs, field.Invalid(
+				rampUpPath.Child("weights").Index(idx),
+				weight,
+				"must be ascending and between 1 and 99",
+			))
+		}
+		previous = weight
+	}
+
+	if rampUp.StepInterval != nil && rampUp.StepInterval.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(
+			rampUpPath.Child("stepInterval"),
+			rampUp.StepInterval.Duration.String(),
+			"must be positive",
+		))
+	}
+
+	return allErrs
+}
+
+func (r *Memcached) validateMemcachedStats() field.ErrorList {
+	memcachedlog.Info("validate stats", "name", r.Name)
+
+	var allErrs field.ErrorList
+	stats := r.Spec.Stats
+	statsPath := field.NewPath("stats")
+
+	// The operator polls with the stats command of the ASCII protocol
+	sasl := r.Spec.Auth.Enable && r.Spec.Auth.Mode == AuthModeSASL
+	if stats.Enable && (sasl || r.Spec.Tuning.Protocol == ProtocolBinary) {
+		allErrs = append(allErrs, field.Invalid(
+			statsPath.Child("enable"),
+			stats.Enable,
+			"stats are polled with the ASCII protocol, they can't be used with SASL or the binary protocol",
+		))
+	}
+
+	if stats.Interval != nil && stats.Interval.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(
+			statsPath.Child("interval"),
+			stats.Interval.Duration.String(),
+			"must be positive",
+		))
+	}
+
+	if rate := stats.Thresholds.MaxEvictionsPerSecond; rate != nil && rate.Sign() < 0 {
+		allErrs = append(allErrs, field.Invalid(
+			statsPath.Child("thresholds").Child("maxEvictionsPerSecond"),
+			rate.String(),
+			"must not be negative",
+		))
+	}
+
+	return allErrs
+}
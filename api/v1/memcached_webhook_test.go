@@ -1,7 +1,16 @@
 package v1
 
 import (
+	"time"
+
 	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
 var _ = Describe("Memcached Webhook", func() {
@@ -28,4 +37,300 @@ var _ = Describe("Memcached Webhook", func() {
 		})
 	})
 
+	Context("When validating the memcached tuning", func() {
+		It("Should admit the memcached defaults", func() {
+			m := &Memcached{}
+			Expect(m.validateMemcachedTuning()).To(BeEmpty())
+		})
+
+		It("Should deny an item size larger than half of the cache", func() {
+			itemSize := resource.MustParse("256Mi")
+			m := &Memcached{Spec: MemcachedSpec{
+				Resources: corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+				},
+				Tuning: Tuning{MaxItemSize: &itemSize},
+			}}
+			Expect(m.validateMemcachedTuning()).To(HaveLen(1))
+		})
+
+		It("Should deny a growth factor not greater than 1", func() {
+			m := &Memcached{Spec: MemcachedSpec{Tuning: Tuning{GrowthFactor: "1.0"}}}
+			Expect(m.validateMemcachedTuning()).To(HaveLen(1))
+		})
+
+		It("Should deny LRU percentages without the LRU maintainer or above 80 together", func() {
+			m := &Memcached{Spec: MemcachedSpec{Tuning: Tuning{
+				LRUMaintainer: &[]bool{false}[0],
+				HotLRUPercent: 50,
+			}}}
+			Expect(m.validateMemcachedTuning()).To(HaveLen(2))
+		})
+	})
+
+	Context("When validating the memory policy", func() {
+		It("Should derive the cache from the memory limit minus 128Mi by default", func() {
+			m := &Memcached{Spec: MemcachedSpec{
+				Resources: corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+				},
+			}}
+			Expect(m.Spec.CacheSize()).To(Equal(int64(384 * 1024 * 1024)))
+			Expect(m.validateMemcachedMemoryPolicy()).To(BeEmpty())
+		})
+
+		It("Should deny a headroom set both as a percentage and as a quantity", func() {
+			headroom := resource.MustParse("64Mi")
+			m := &Memcached{Spec: MemcachedSpec{Memory: MemoryPolicy{
+				HeadroomPercent: &[]int32{10}[0],
+				Headroom:        &headroom,
+			}}}
+			Expect(m.validateMemcachedMemoryPolicy()).To(HaveLen(1))
+		})
+
+		It("Should deny a cache size above the memory limit", func() {
+			cacheSize := resource.MustParse("1Gi")
+			m := &Memcached{Spec: MemcachedSpec{
+				Resources: corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+				},
+				Memory: MemoryPolicy{CacheSize: &cacheSize},
+			}}
+			Expect(m.validateMemcachedMemoryPolicy()).To(HaveLen(1))
+		})
+	})
+
+	Context("When validating the extstore", func() {
+		It("Should require the extstore size", func() {
+			m := &Memcached{Spec: MemcachedSpec{Extstore: Extstore{Enable: true}}}
+			Expect(m.validateMemcachedExtstore()).To(HaveLen(1))
+		})
+
+		It("Should deny write buffers not fitting next to the cache", func() {
+			writeBufferSize := resource.MustParse("32Mi")
+			m := &Memcached{Spec: MemcachedSpec{
+				Resources: corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+				},
+				Extstore: Extstore{
+					Enable:          true,
+					Size:            resource.MustParse("10Gi"),
+					WriteBufferSize: &writeBufferSize,
+					Threads:         8,
+				},
+			}}
+			Expect(m.validateMemcachedExtstore()).To(HaveLen(1))
+
+			m.Spec.Extstore.Threads = 2
+			Expect(m.validateMemcachedExtstore()).To(BeEmpty())
+		})
+
+		It("Should deny a storage class on an emptyDir", func() {
+			m := &Memcached{Spec: MemcachedSpec{Extstore: Extstore{
+				Enable: true,
+				Size:   resource.MustParse("1Gi"),
+				Volume: ExtstoreVolume{StorageClassName: &[]string{"fast"}[0]},
+			}}}
+			Expect(m.validateMemcachedExtstore()).To(HaveLen(1))
+		})
+	})
+
+	Context("When validating the auth", func() {
+		It("Should default to the ASCII auth file", func() {
+			m := &Memcached{Spec: MemcachedSpec{Auth: Auth{Enable: true, SecretName: "memcached-auth"}}}
+			m.Default()
+			Expect(m.Spec.Auth.Mode).To(Equal(AuthModeASCII))
+			Expect(m.Spec.Auth.SecretKey).To(Equal(DefaultAuthSecretKey))
+			Expect(m.validateMemcachedAuth()).To(BeEmpty())
+		})
+
+		It("Should require the Secret name", func() {
+			m := &Memcached{Spec: MemcachedSpec{Auth: Auth{Enable: true}}}
+			Expect(m.validateMemcachedAuth()).To(HaveLen(1))
+		})
+
+		It("Should deny SASL over the ASCII protocol", func() {
+			m := &Memcached{Spec: MemcachedSpec{
+				Auth:   Auth{Enable: true, Mode: AuthModeSASL, SecretName: "memcached-auth"},
+				Tuning: Tuning{Protocol: ProtocolASCII},
+			}}
+			Expect(m.validateMemcachedAuth()).To(HaveLen(1))
+		})
+
+		It("Should warn that the proxy can't authenticate", func() {
+			m := &Memcached{Spec: MemcachedSpec{
+				Auth:  Auth{Enable: true, SecretName: "memcached-auth"},
+				Proxy: Proxy{Enable: true},
+			}}
+			Expect(m.memcachedWarnings()).To(ContainElement(ContainSubstring("twemproxy")))
+		})
+	})
+
+	Context("When validating the TLS", func() {
+		It("Should require a Secret without cert-manager", func() {
+			m := &Memcached{Spec: MemcachedSpec{TLS: TLS{Enable: true}}}
+			Expect(m.validateMemcachedTLS()).To(HaveLen(1))
+		})
+
+		It("Should default the cert-manager Secret and issuer", func() {
+			m := &Memcached{Spec: MemcachedSpec{TLS: TLS{
+				Enable:      true,
+				CertManager: &CertManager{IssuerRef: IssuerReference{Name: "ca-issuer"}},
+			}}}
+			m.Name = "memcached-sample"
+			m.Default()
+			Expect(m.Spec.TLS.SecretName).To(Equal("memcached-sample-tls"))
+			Expect(m.Spec.TLS.CertManager.IssuerRef.Kind).To(Equal("Issuer"))
+			Expect(m.validateMemcachedTLS()).To(BeEmpty())
+		})
+	})
+
+	Context("When validating the monitoring", func() {
+		It("Should warn that the exporter can't authenticate", func() {
+			m := &Memcached{Spec: MemcachedSpec{
+				Auth:       Auth{Enable: true, SecretName: "memcached-auth"},
+				Monitoring: Monitoring{Enable: true},
+			}}
+			Expect(m.memcachedWarnings()).To(ContainElement(ContainSubstring("memcached_exporter")))
+		})
+	})
+
+	Context("When validating the probes", func() {
+		It("Should deny a liveness success threshold above 1", func() {
+			m := &Memcached{Spec: MemcachedSpec{
+				Probes: Probes{Liveness: &ProbeOverrides{SuccessThreshold: 2}},
+				Proxy:  Proxy{Probes: Probes{Readiness: &ProbeOverrides{SuccessThreshold: 2}}},
+			}}
+			Expect(validateProbes(field.NewPath("probes"), m.Spec.Probes)).To(HaveLen(1))
+			Expect(validateProbes(field.NewPath("proxy").Child("probes"), m.Spec.Proxy.Probes)).To(BeEmpty())
+		})
+	})
+
+	Context("When validating the disruption budgets", func() {
+		It("Should admit integers and percentages", func() {
+			Expect(validateMaxUnavailable(field.NewPath("maxUnavailable"), &[]intstr.IntOrString{intstr.FromInt32(2)}[0])).To(BeEmpty())
+			Expect(validateMaxUnavailable(field.NewPath("maxUnavailable"), &[]intstr.IntOrString{intstr.FromString("25%")}[0])).To(BeEmpty())
+		})
+
+		It("Should deny a budget that blocks drains", func() {
+			Expect(validateMaxUnavailable(field.NewPath("maxUnavailable"), &[]intstr.IntOrString{intstr.FromInt32(0)}[0])).To(HaveLen(1))
+			Expect(validateMaxUnavailable(field.NewPath("maxUnavailable"), &[]intstr.IntOrString{intstr.FromString("half")}[0])).To(HaveLen(1))
+		})
+	})
+
+	Context("When validating the Services", func() {
+		It("Should admit a dual-stack LoadBalancer", func() {
+			m := &Memcached{Spec: MemcachedSpec{Service: ServiceSpec{
+				Type:                     corev1.ServiceTypeLoadBalancer,
+				LoadBalancerSourceRanges: []string{"10.0.0.0/8"},
+				ExternalTrafficPolicy:    corev1.ServiceExternalTrafficPolicyLocal,
+				IPFamilies:               []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol},
+				IPFamilyPolicy:           &[]corev1.IPFamilyPolicy{corev1.IPFamilyPolicyPreferDualStack}[0],
+			}}}
+			Expect(m.validateMemcachedService()).To(BeEmpty())
+		})
+
+		It("Should deny settings that don't fit the Service type", func() {
+			m := &Memcached{Spec: MemcachedSpec{Service: ServiceSpec{
+				LoadBalancerSourceRanges: []string{"10.0.0.0"},
+				ExternalTrafficPolicy:    corev1.ServiceExternalTrafficPolicyLocal,
+			}}}
+			// not a LoadBalancer, not a CIDR, a ClusterIP with an external policy
+			Expect(m.validateMemcachedService()).To(HaveLen(3))
+		})
+
+		It("Should deny two IP families without dual-stack", func() {
+			m := &Memcached{Spec: MemcachedSpec{Proxy: Proxy{Service: ServiceSpec{
+				IPFamilies: []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv4Protocol},
+			}}}}
+			Expect(m.validateMemcachedService()).To(HaveLen(2))
+		})
+
+		It("Should deny UDP on the proxy and together with TLS", func() {
+			m := &Memcached{Spec: MemcachedSpec{
+				Service: ServiceSpec{UDP: true},
+				TLS:     TLS{Enable: true, SecretName: "memcached-tls"},
+				Proxy:   Proxy{Service: ServiceSpec{UDP: true}},
+			}}
+			Expect(m.validateMemcachedService()).To(HaveLen(2))
+		})
+	})
+
+	Context("When validating the scaling", func() {
+		It("Should default the drain period and deny a negative one", func() {
+			m := &Memcached{}
+			Expect(m.Spec.DrainPeriod()).To(Equal(DefaultDrainPeriod))
+			Expect(m.validateMemcachedScaling()).To(BeEmpty())
+
+			m.Spec.Scaling.DrainPeriod = &metav1.Duration{Duration: -time.Second}
+			Expect(m.validateMemcachedScaling()).To(HaveLen(1))
+		})
+
+		It("Should deny an empty step and a negative step interval", func() {
+			m := &Memcached{Spec: MemcachedSpec{Scaling: Scaling{
+				MaxStepDown:         &[]intstr.IntOrString{intstr.FromInt32(0)}[0],
+				StepInterval:        &metav1.Duration{Duration: -time.Second},
+				StabilizationWindow: &metav1.Duration{Duration: 5 * time.Minute},
+			}}}
+			Expect(m.validateMemcachedScaling()).To(HaveLen(2))
+
+			m.Spec.Scaling.MaxStepDown = &[]intstr.IntOrString{intstr.FromString("25%")}[0]
+			m.Spec.Scaling.StepInterval = nil
+			Expect(m.validateMemcachedScaling()).To(BeEmpty())
+			Expect(m.Spec.StepInterval()).To(Equal(DefaultStepInterval))
+		})
+	})
+
+	Context("When validating the stats", func() {
+		It("Should default the interval and deny stats without the ASCII protocol", func() {
+			m := &Memcached{Spec: MemcachedSpec{Stats: Stats{Enable: true}}}
+			Expect(m.Spec.StatsInterval()).To(Equal(DefaultStatsInterval))
+			Expect(m.validateMemcachedStats()).To(BeEmpty())
+
+			m.Spec.Tuning.Protocol = ProtocolBinary
+			m.Spec.Stats.Interval = &metav1.Duration{}
+			m.Spec.Stats.Thresholds.MaxEvictionsPerSecond = &[]resource.Quantity{resource.MustParse("-1")}[0]
+			Expect(m.validateMemcachedStats()).To(HaveLen(3))
+		})
+	})
+
+	Context("When validating the proxy ramp-up", func() {
+		It("Should default the weights and deny a schedule that doesn't raise them", func() {
+			m := &Memcached{Spec: MemcachedSpec{Proxy: Proxy{RampUp: RampUp{Enable: true}}}}
+			Expect(m.Spec.Proxy.RampUpWeights()).To(Equal(DefaultRampUpWeights))
+			Expect(m.validateProxyRampUp()).To(BeEmpty())
+
+			m.Spec.Proxy.RampUp.Weights = []int32{10, 10, 100}
+			m.Spec.Proxy.RampUp.StepInterval = &metav1.Duration{}
+			Expect(m.validateProxyRampUp()).To(HaveLen(3))
+		})
+
+		It("Should warn that explicit servers are not ramped up", func() {
+			m := &Memcached{Spec: MemcachedSpec{Proxy: Proxy{
+				Enable: true,
+				RampUp: RampUp{Enable: true},
+				Config: ProxyConfig{Servers: []string{"10.0.0.1:11211:1"}},
+			}}}
+			Expect(m.memcachedWarnings()).To(ContainElement(ContainSubstring("rampUp")))
+		})
+	})
+
+	Context("When validating the pod template", func() {
+		It("Should deny the labels set by the operator", func() {
+			podTemplate := PodTemplate{Labels: map[string]string{
+				"team":                         "cache",
+				"app.kubernetes.io/instance":   "other",
+				"app.kubernetes.io/managed-by": "helm",
+			}}
+			errs := validatePodTemplate(field.NewPath("podTemplate"), podTemplate)
+			Expect(errs).To(HaveLen(2))
+			Expect(errs.ToAggregate().Error()).To(And(
+				ContainSubstring("podTemplate.labels[app.kubernetes.io/instance]"),
+				ContainSubstring("podTemplate.labels[app.kubernetes.io/managed-by]"),
+			))
+
+			podTemplate.Labels = map[string]string{"team": "cache"}
+			Expect(validatePodTemplate(field.NewPath("podTemplate"), podTemplate)).To(BeEmpty())
+		})
+	})
 })
@@ -21,9 +21,53 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Auth) DeepCopyInto(out *Auth) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Auth.
+func (in *Auth) DeepCopy() *Auth {
+	if in == nil {
+		return nil
+	}
+	out := new(Auth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertManager) DeepCopyInto(out *CertManager) {
+	*out = *in
+	out.IssuerRef = in.IssuerRef
+	if in.Duration != nil {
+		in, out := &in.Duration, &out.Duration
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.RenewBefore != nil {
+		in, out := &in.RenewBefore, &out.RenewBefore
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertManager.
+func (in *CertManager) DeepCopy() *CertManager {
+	if in == nil {
+		return nil
+	}
+	out := new(CertManager)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DockerImage) DeepCopyInto(out *DockerImage) {
 	*out = *in
@@ -39,6 +83,98 @@ func (in *DockerImage) DeepCopy() *DockerImage {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EndpointStatus) DeepCopyInto(out *EndpointStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EndpointStatus.
+func (in *EndpointStatus) DeepCopy() *EndpointStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(EndpointStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Extstore) DeepCopyInto(out *Extstore) {
+	*out = *in
+	out.Size = in.Size.DeepCopy()
+	if in.WriteBufferSize != nil {
+		in, out := &in.WriteBufferSize, &out.WriteBufferSize
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.ItemSize != nil {
+		in, out := &in.ItemSize, &out.ItemSize
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	in.Volume.DeepCopyInto(&out.Volume)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Extstore.
+func (in *Extstore) DeepCopy() *Extstore {
+	if in == nil {
+		return nil
+	}
+	out := new(Extstore)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExtstoreVolume) DeepCopyInto(out *ExtstoreVolume) {
+	*out = *in
+	if in.StorageClassName != nil {
+		in, out := &in.StorageClassName, &out.StorageClassName
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExtstoreVolume.
+func (in *ExtstoreVolume) DeepCopy() *ExtstoreVolume {
+	if in == nil {
+		return nil
+	}
+	out := new(ExtstoreVolume)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImagesStatus) DeepCopyInto(out *ImagesStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImagesStatus.
+func (in *ImagesStatus) DeepCopy() *ImagesStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ImagesStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IssuerReference) DeepCopyInto(out *IssuerReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IssuerReference.
+func (in *IssuerReference) DeepCopy() *IssuerReference {
+	if in == nil {
+		return nil
+	}
+	out := new(IssuerReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Memcached) DeepCopyInto(out *Memcached) {
 	*out = *in
@@ -66,22 +202,6 @@ func (in *Memcached) DeepCopyObject() runtime.Object {
 	return nil
 }
 
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *MemcachedCondition) DeepCopyInto(out *MemcachedCondition) {
-	*out = *in
-	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MemcachedCondition.
-func (in *MemcachedCondition) DeepCopy() *MemcachedCondition {
-	if in == nil {
-		return nil
-	}
-	out := new(MemcachedCondition)
-	in.DeepCopyInto(out)
-	return out
-}
-
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MemcachedList) DeepCopyInto(out *MemcachedList) {
 	*out = *in
@@ -119,6 +239,22 @@ func (in *MemcachedSpec) DeepCopyInto(out *MemcachedSpec) {
 	*out = *in
 	out.Image = in.Image
 	in.Resources.DeepCopyInto(&out.Resources)
+	in.Memory.DeepCopyInto(&out.Memory)
+	in.Tuning.DeepCopyInto(&out.Tuning)
+	in.Extstore.DeepCopyInto(&out.Extstore)
+	out.Auth = in.Auth
+	in.TLS.DeepCopyInto(&out.TLS)
+	in.Monitoring.DeepCopyInto(&out.Monitoring)
+	in.Probes.DeepCopyInto(&out.Probes)
+	in.PodTemplate.DeepCopyInto(&out.PodTemplate)
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	in.Service.DeepCopyInto(&out.Service)
+	in.Scaling.DeepCopyInto(&out.Scaling)
+	in.Stats.DeepCopyInto(&out.Stats)
 	in.Proxy.DeepCopyInto(&out.Proxy)
 }
 
@@ -137,11 +273,43 @@ func (in *MemcachedStatus) DeepCopyInto(out *MemcachedStatus) {
 	*out = *in
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
-		*out = make([]MemcachedCondition, len(*in))
+		*out = make([]metav1.Condition, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	out.Proxy = in.Proxy
+	if in.MemoryLimit != nil {
+		in, out := &in.MemoryLimit, &out.MemoryLimit
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.DecommissioningPods != nil {
+		in, out := &in.DecommissioningPods, &out.DecommissioningPods
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Scaling != nil {
+		in, out := &in.Scaling, &out.Scaling
+		*out = new(ScalingStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Endpoints != nil {
+		in, out := &in.Endpoints, &out.Endpoints
+		*out = make([]EndpointStatus, len(*in))
+		copy(*out, *in)
+	}
+	out.Images = in.Images
+	if in.Stats != nil {
+		in, out := &in.Stats, &out.Stats
+		*out = new(StatsStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OptionalResources != nil {
+		in, out := &in.OptionalResources, &out.OptionalResources
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MemcachedStatus.
@@ -154,12 +322,181 @@ func (in *MemcachedStatus) DeepCopy() *MemcachedStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MemoryPolicy) DeepCopyInto(out *MemoryPolicy) {
+	*out = *in
+	if in.CacheSize != nil {
+		in, out := &in.CacheSize, &out.CacheSize
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.HeadroomPercent != nil {
+		in, out := &in.HeadroomPercent, &out.HeadroomPercent
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Headroom != nil {
+		in, out := &in.Headroom, &out.Headroom
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MemoryPolicy.
+func (in *MemoryPolicy) DeepCopy() *MemoryPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(MemoryPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Monitoring) DeepCopyInto(out *Monitoring) {
+	*out = *in
+	out.ExporterImage = in.ExporterImage
+	out.ProxyExporterImage = in.ProxyExporterImage
+	in.Resources.DeepCopyInto(&out.Resources)
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Monitoring.
+func (in *Monitoring) DeepCopy() *Monitoring {
+	if in == nil {
+		return nil
+	}
+	out := new(Monitoring)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodTemplate) DeepCopyInto(out *PodTemplate) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Affinity != nil {
+		in, out := &in.Affinity, &out.Affinity
+		*out = new(corev1.Affinity)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TopologySpreadConstraints != nil {
+		in, out := &in.TopologySpreadConstraints, &out.TopologySpreadConstraints
+		*out = make([]corev1.TopologySpreadConstraint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]corev1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodTemplate.
+func (in *PodTemplate) DeepCopy() *PodTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(PodTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProbeOverrides) DeepCopyInto(out *ProbeOverrides) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProbeOverrides.
+func (in *ProbeOverrides) DeepCopy() *ProbeOverrides {
+	if in == nil {
+		return nil
+	}
+	out := new(ProbeOverrides)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Probes) DeepCopyInto(out *Probes) {
+	*out = *in
+	if in.Liveness != nil {
+		in, out := &in.Liveness, &out.Liveness
+		*out = new(ProbeOverrides)
+		**out = **in
+	}
+	if in.Readiness != nil {
+		in, out := &in.Readiness, &out.Readiness
+		*out = new(ProbeOverrides)
+		**out = **in
+	}
+	if in.Startup != nil {
+		in, out := &in.Startup, &out.Startup
+		*out = new(ProbeOverrides)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Probes.
+func (in *Probes) DeepCopy() *Probes {
+	if in == nil {
+		return nil
+	}
+	out := new(Probes)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Proxy) DeepCopyInto(out *Proxy) {
 	*out = *in
 	out.Image = in.Image
 	in.Resources.DeepCopyInto(&out.Resources)
 	in.Config.DeepCopyInto(&out.Config)
+	in.Probes.DeepCopyInto(&out.Probes)
+	in.PodTemplate.DeepCopyInto(&out.PodTemplate)
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	in.Service.DeepCopyInto(&out.Service)
+	in.RampUp.DeepCopyInto(&out.RampUp)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Proxy.
@@ -191,3 +528,272 @@ func (in *ProxyConfig) DeepCopy() *ProxyConfig {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProxyStatus) DeepCopyInto(out *ProxyStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProxyStatus.
+func (in *ProxyStatus) DeepCopy() *ProxyStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ProxyStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RampUp) DeepCopyInto(out *RampUp) {
+	*out = *in
+	if in.Weights != nil {
+		in, out := &in.Weights, &out.Weights
+		*out = make([]int32, len(*in))
+		copy(*out, *in)
+	}
+	if in.StepInterval != nil {
+		in, out := &in.StepInterval, &out.StepInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RampUp.
+func (in *RampUp) DeepCopy() *RampUp {
+	if in == nil {
+		return nil
+	}
+	out := new(RampUp)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Scaling) DeepCopyInto(out *Scaling) {
+	*out = *in
+	if in.DrainPeriod != nil {
+		in, out := &in.DrainPeriod, &out.DrainPeriod
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MaxStepDown != nil {
+		in, out := &in.MaxStepDown, &out.MaxStepDown
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.StepInterval != nil {
+		in, out := &in.StepInterval, &out.StepInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.StabilizationWindow != nil {
+		in, out := &in.StabilizationWindow, &out.StabilizationWindow
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Scaling.
+func (in *Scaling) DeepCopy() *Scaling {
+	if in == nil {
+		return nil
+	}
+	out := new(Scaling)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScalingStatus) DeepCopyInto(out *ScalingStatus) {
+	*out = *in
+	in.Since.DeepCopyInto(&out.Since)
+	if in.LastStepTime != nil {
+		in, out := &in.LastStepTime, &out.LastStepTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScalingStatus.
+func (in *ScalingStatus) DeepCopy() *ScalingStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ScalingStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceSpec) DeepCopyInto(out *ServiceSpec) {
+	*out = *in
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.LoadBalancerSourceRanges != nil {
+		in, out := &in.LoadBalancerSourceRanges, &out.LoadBalancerSourceRanges
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.InternalTrafficPolicy != nil {
+		in, out := &in.InternalTrafficPolicy, &out.InternalTrafficPolicy
+		*out = new(corev1.ServiceInternalTrafficPolicy)
+		**out = **in
+	}
+	if in.IPFamilies != nil {
+		in, out := &in.IPFamilies, &out.IPFamilies
+		*out = make([]corev1.IPFamily, len(*in))
+		copy(*out, *in)
+	}
+	if in.IPFamilyPolicy != nil {
+		in, out := &in.IPFamilyPolicy, &out.IPFamilyPolicy
+		*out = new(corev1.IPFamilyPolicy)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceSpec.
+func (in *ServiceSpec) DeepCopy() *ServiceSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Stats) DeepCopyInto(out *Stats) {
+	*out = *in
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	in.Thresholds.DeepCopyInto(&out.Thresholds)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Stats.
+func (in *Stats) DeepCopy() *Stats {
+	if in == nil {
+		return nil
+	}
+	out := new(Stats)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StatsStatus) DeepCopyInto(out *StatsStatus) {
+	*out = *in
+	if in.PolledPods != nil {
+		in, out := &in.PolledPods, &out.PolledPods
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.LastPollTime.DeepCopyInto(&out.LastPollTime)
+	if in.ThresholdsExceeded != nil {
+		in, out := &in.ThresholdsExceeded, &out.ThresholdsExceeded
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StatsStatus.
+func (in *StatsStatus) DeepCopy() *StatsStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(StatsStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StatsThresholds) DeepCopyInto(out *StatsThresholds) {
+	*out = *in
+	if in.MaxEvictionsPerSecond != nil {
+		in, out := &in.MaxEvictionsPerSecond, &out.MaxEvictionsPerSecond
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.MinHitRatio != nil {
+		in, out := &in.MinHitRatio, &out.MinHitRatio
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxMemoryUsage != nil {
+		in, out := &in.MaxMemoryUsage, &out.MaxMemoryUsage
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxConnections != nil {
+		in, out := &in.MaxConnections, &out.MaxConnections
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StatsThresholds.
+func (in *StatsThresholds) DeepCopy() *StatsThresholds {
+	if in == nil {
+		return nil
+	}
+	out := new(StatsThresholds)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TLS) DeepCopyInto(out *TLS) {
+	*out = *in
+	if in.CertManager != nil {
+		in, out := &in.CertManager, &out.CertManager
+		*out = new(CertManager)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TLS.
+func (in *TLS) DeepCopy() *TLS {
+	if in == nil {
+		return nil
+	}
+	out := new(TLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Tuning) DeepCopyInto(out *Tuning) {
+	*out = *in
+	if in.MaxItemSize != nil {
+		in, out := &in.MaxItemSize, &out.MaxItemSize
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.LRUCrawler != nil {
+		in, out := &in.LRUCrawler, &out.LRUCrawler
+		*out = new(bool)
+		**out = **in
+	}
+	if in.LRUMaintainer != nil {
+		in, out := &in.LRUMaintainer, &out.LRUMaintainer
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Tuning.
+func (in *Tuning) DeepCopy() *Tuning {
+	if in == nil {
+		return nil
+	}
+	out := new(Tuning)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -5,14 +5,20 @@ import (
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -32,18 +38,27 @@ type MemcachedReconciler struct {
 }
 
 var (
-	cooldownPeriod     = 20 * time.Second
 	minimumRequeueTime = 500 * time.Millisecond
 )
 
+const (
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedByValue = "memcached-operator"
+)
+
 // +kubebuilder:rbac:groups=cache.bsod.io,resources=memcacheds,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=cache.bsod.io,resources=memcacheds/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=cache.bsod.io,resources=memcacheds/finalizers,verbs=update
 // +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors;prometheusrules,verbs=get;list;watch;create;update;patch;delete
 
 func (r *MemcachedReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	startReconcile := time.Now()
@@ -92,31 +107,132 @@ func (r *MemcachedReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	return res, err
 }
 
-func hasLabel(labels map[string]string, lablel string) bool {
-	v, ok := labels[lablel]
-	return ok && v == lablel
+func hasLabel(labels map[string]string, label, value string) bool {
+	v, ok := labels[label]
+	return ok && v == value
+}
+
+func isManaged(obj client.Object) bool {
+	return hasLabel(obj.GetLabels(), managedByLabel, managedByValue)
+}
+
+// ClientOptions reads the Secrets straight from the API server, only their metadata is cached
+// for the watch
+func ClientOptions() client.Options {
+	return client.Options{
+		Cache: &client.CacheOptions{
+			DisableFor: []client.Object{&corev1.Secret{}},
+		},
+	}
+}
+
+// CacheOptions restricts the manager cache to the pods the operator runs, every pod in the
+// cluster would be cached otherwise
+func CacheOptions() cache.Options {
+	return cache.Options{
+		ByObject: map[client.Object]cache.ByObject{
+			&corev1.Pod{}: {
+				Label: labels.SelectorFromSet(labels.Set{managedByLabel: managedByValue}),
+			},
+		},
+	}
+}
+
+// memcachedPodToRequest maps a Memcached pod to its owning Memcached resource, so membership
+// changes reach the proxy config without waiting for a Deployment event
+func memcachedPodToRequest(_ context.Context, obj client.Object) []reconcile.Request {
+	labels := obj.GetLabels()
+	if labels["app.kubernetes.io/name"] != "Memcached" || labels["app.kubernetes.io/instance"] == "" {
+		return nil
+	}
+
+	return []reconcile.Request{{
+		NamespacedName: types.NamespacedName{
+			Name:      labels["app.kubernetes.io/instance"],
+			Namespace: obj.GetNamespace(),
+		},
+	}}
+}
+
+// secretNamesField indexes the Memcached resources by the Secrets they use for auth or TLS
+const secretNamesField = ".spec.secretNames"
+
+// memcachedSecretNames returns the Secrets a Memcached uses for auth or TLS
+func memcachedSecretNames(obj client.Object) []string {
+	m := obj.(*cachev1.Memcached)
+
+	var names []string
+	if m.Spec.Auth.Enable && m.Spec.Auth.SecretName != "" {
+		names = append(names, m.Spec.Auth.SecretName)
+	}
+	if m.Spec.TLS.Enable {
+		if m.Spec.TLS.SecretName != "" {
+			names = append(names, m.Spec.TLS.SecretName)
+		} else {
+			names = append(names, m.Name+"-tls")
+		}
+	}
+	return names
+}
+
+// secretToRequests maps a Secret to the Memcached resources using it for auth or TLS, so rotated
+// credentials roll the pods and rotated certificates get reloaded
+func (r *MemcachedReconciler) secretToRequests(ctx context.Context, obj client.Object) []reconcile.Request {
+	memcachedList := &cachev1.MemcachedList{}
+	if err := r.List(ctx, memcachedList,
+		client.InNamespace(obj.GetNamespace()),
+		client.MatchingFields{secretNamesField: obj.GetName()},
+	); err != nil {
+		log.FromContext(ctx).Error(err, "error listing the Memcached resources for a Secret", "secret", obj.GetName())
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(memcachedList.Items))
+	for _, m := range memcachedList.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      m.Name,
+				Namespace: m.Namespace,
+			},
+		})
+	}
+	return requests
 }
 
 func (r *MemcachedReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &cachev1.Memcached{},
+		secretNamesField, memcachedSecretNames); err != nil {
+		return err
+	}
 
+	// Owned objects are filtered on the managed-by label, an edit that strips it is still
+	// reported through ObjectOld so the label gets put back
 	memcachedPredicate := predicate.Funcs{
 		CreateFunc: func(e event.CreateEvent) bool {
-			return hasLabel(e.Object.GetLabels(), "app.kubernetes.io/managed-by")
+			return isManaged(e.Object)
 		},
 		DeleteFunc: func(e event.DeleteEvent) bool {
-			return hasLabel(e.Object.GetLabels(), "app.kubernetes.io/managed-by")
+			return isManaged(e.Object)
 		},
 		UpdateFunc: func(e event.UpdateEvent) bool {
-			return hasLabel(e.ObjectOld.GetLabels(), "app.kubernetes.io/managed-by") || hasLabel(e.ObjectNew.GetLabels(), "app.kubernetes.io/managed-by")
+			return isManaged(e.ObjectOld) || isManaged(e.ObjectNew)
 		},
 		GenericFunc: func(e event.GenericEvent) bool {
-			return hasLabel(e.Object.GetLabels(), "app.kubernetes.io/managed-by")
+			return isManaged(e.Object)
 		},
 	}
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&cachev1.Memcached{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
 		Owns(&appsv1.Deployment{}, builder.WithPredicates(memcachedPredicate)).
+		Owns(&appsv1.StatefulSet{}, builder.WithPredicates(memcachedPredicate)).
+		Owns(&corev1.Service{}, builder.WithPredicates(memcachedPredicate)).
+		Owns(&corev1.ConfigMap{}, builder.WithPredicates(memcachedPredicate)).
+		Owns(&policyv1.PodDisruptionBudget{}, builder.WithPredicates(memcachedPredicate)).
+		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(memcachedPodToRequest),
+			builder.WithPredicates(memcachedPredicate)).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.secretToRequests),
+			builder.OnlyMetadata).
 		Complete(r)
 }
 
@@ -10,10 +10,14 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
@@ -98,8 +102,9 @@ var _ = Describe("Memcached controller", func() {
 
 			By("Reconciling the custom resource created")
 			memcachedReconciler := &MemcachedReconciler{
-				Client: k8sClient,
-				Scheme: k8sClient.Scheme(),
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
 			}
 
 			_, err := memcachedReconciler.Reconcile(ctx, reconcile.Request{
@@ -113,26 +118,157 @@ var _ = Describe("Memcached controller", func() {
 				return k8sClient.Get(ctx, typeNamespaceName, found)
 			}, time.Minute, time.Second).Should(Succeed())
 
-			By("Checking the latest Status Condition added to the Memcached instance")
+			By("Checking the Ready condition of the Memcached instance")
 			Eventually(func() error {
-				if memcached.Status.Conditions != nil &&
-					len(memcached.Status.Conditions) != 0 {
-					latestStatusCondition := memcached.Status.Conditions[len(memcached.Status.Conditions)-1]
-					expectedLatestStatusCondition := cachev1.MemcachedCondition{
-						Type:   cachev1.MemcachedReady,
-						Status: corev1.ConditionTrue,
-						Reason: "Reconciling",
-						Message: fmt.Sprintf(
-							"Deployment for custom resource (%s) with %d replicas created successfully",
-							memcached.Name,
-							memcached.Spec.Size),
-					}
-					if latestStatusCondition != expectedLatestStatusCondition {
-						return fmt.Errorf("The latest status condition added to the Memcached instance is not as expected")
-					}
+				found := &cachev1.Memcached{}
+				if err := k8sClient.Get(ctx, typeNamespaceName, found); err != nil {
+					return err
+				}
+
+				// envtest runs no Deployment controller, the pods never become ready
+				condition := meta.FindStatusCondition(found.Status.Conditions, string(cachev1.MemcachedReady))
+				if condition == nil {
+					return fmt.Errorf("the Ready condition is not set")
+				}
+				if condition.Status != metav1.ConditionFalse || condition.Reason != "PodsNotReady" {
+					return fmt.Errorf("unexpected Ready condition %s/%s", condition.Status, condition.Reason)
+				}
+				if condition.ObservedGeneration != found.Generation {
+					return fmt.Errorf("the Ready condition was computed for generation %d", condition.ObservedGeneration)
+				}
+				if found.Status.ObservedGeneration == found.Generation {
+					return fmt.Errorf("the observed generation advanced before the rollout")
 				}
 				return nil
 			}, time.Minute, time.Second).Should(Succeed())
 		})
 	})
+
+	Context("Memcached scale subresource test", func() {
+
+		const MemcachedName = "test-memcached-scale"
+
+		ctx := context.Background()
+
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      MemcachedName,
+				Namespace: MemcachedName,
+			},
+		}
+
+		typeNamespaceName := types.NamespacedName{
+			Name:      MemcachedName,
+			Namespace: MemcachedName,
+		}
+
+		BeforeEach(func() {
+			By("Creating the Namespace to perform the tests")
+			err := k8sClient.Create(ctx, namespace)
+			Expect(err).To(Not(HaveOccurred()))
+
+			By("creating the custom resource for the Kind Memcached")
+			memcached := &cachev1.Memcached{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      MemcachedName,
+					Namespace: namespace.Name,
+				},
+				Spec: cachev1.MemcachedSpec{
+					Size:          1,
+					ContainerPort: 11211,
+				},
+			}
+			err = k8sClient.Create(ctx, memcached)
+			Expect(err).To(Not(HaveOccurred()))
+		})
+
+		AfterEach(func() {
+			By("removing the custom resource for the Kind Memcached")
+			found := &cachev1.Memcached{}
+			err := k8sClient.Get(ctx, typeNamespaceName, found)
+			Expect(err).To(Not(HaveOccurred()))
+
+			Eventually(func() error {
+				return k8sClient.Delete(context.TODO(), found)
+			}, 2*time.Minute, time.Second).Should(Succeed())
+
+			By("Deleting the Namespace to perform the tests")
+			_ = k8sClient.Delete(ctx, namespace)
+		})
+
+		It("should scale the Memcached through the scale subresource", func() {
+			memcachedReconciler := &MemcachedReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+			}
+
+			By("Reconciling the custom resource created")
+			_, err := memcachedReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespaceName,
+			})
+			Expect(err).To(Not(HaveOccurred()))
+
+			memcached := &cachev1.Memcached{}
+			Expect(k8sClient.Get(ctx, typeNamespaceName, memcached)).To(Succeed())
+
+			By("Reading the scale subresource")
+			scale := &autoscalingv1.Scale{}
+			Expect(k8sClient.SubResource("scale").Get(ctx, memcached, scale)).To(Succeed())
+			Expect(scale.Spec.Replicas).To(Equal(int32(1)))
+			Expect(scale.Status.Selector).To(Equal(
+				"app.kubernetes.io/instance=test-memcached-scale,app.kubernetes.io/name=Memcached"))
+
+			By("Scaling the Memcached like kubectl scale and the HorizontalPodAutoscaler do")
+			scale.Spec.Replicas = 3
+			Expect(k8sClient.SubResource("scale").Update(ctx, memcached, client.WithSubResourceBody(scale))).To(Succeed())
+
+			Expect(k8sClient.Get(ctx, typeNamespaceName, memcached)).To(Succeed())
+			Expect(memcached.Spec.Size).To(Equal(int32(3)))
+
+			By("Checking the Deployment follows the new size")
+			Eventually(func() error {
+				if _, err := memcachedReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespaceName,
+				}); err != nil {
+					return err
+				}
+
+				found := &appsv1.Deployment{}
+				if err := k8sClient.Get(ctx, typeNamespaceName, found); err != nil {
+					return err
+				}
+				if *found.Spec.Replicas != 3 {
+					return fmt.Errorf("the Deployment has %d replicas", *found.Spec.Replicas)
+				}
+				return nil
+			}, time.Minute, time.Second).Should(Succeed())
+
+			By("Checking the selector stays in status")
+			Expect(k8sClient.SubResource("scale").Get(ctx, memcached, scale)).To(Succeed())
+			Expect(scale.Spec.Replicas).To(Equal(int32(3)))
+			Expect(scale.Status.Selector).To(Equal(
+				"app.kubernetes.io/instance=test-memcached-scale,app.kubernetes.io/name=Memcached"))
+		})
+	})
+
+	Context("Memcached Secret index test", func() {
+		It("should index the Secrets used for auth and TLS", func() {
+			memcached := &cachev1.Memcached{
+				ObjectMeta: metav1.ObjectMeta{Name: "cache"},
+				Spec: cachev1.MemcachedSpec{
+					Auth: cachev1.Auth{Enable: true, SecretName: "cache-auth"},
+					TLS:  cachev1.TLS{Enable: true},
+				},
+			}
+			Expect(memcachedSecretNames(memcached)).To(Equal([]string{"cache-auth", "cache-tls"}))
+
+			memcached.Spec.TLS.SecretName = "custom-tls"
+			Expect(memcachedSecretNames(memcached)).To(Equal([]string{"cache-auth", "custom-tls"}))
+
+			memcached.Spec.Auth.Enable = false
+			memcached.Spec.TLS.Enable = false
+			Expect(memcachedSecretNames(memcached)).To(BeEmpty())
+		})
+	})
 })
@@ -12,10 +12,17 @@ const (
 	// Events
 	DeletingStuckPod string = "DeletingStuckPod"
 	CreatedResource  string = "CreatedResource"
+	UpdatedResource  string = "UpdatedResource"
+	DeletedResource  string = "DeletedResource"
+	DriftCorrected   string = "DriftCorrected"
+	RollingRestart   string = "RollingRestart"
 	ScalingUp        string = "ScalingUp"
 	ScalingDown      string = "ScalingDown"
+	ProxyScalingUp   string = "ProxyScalingUp"
+	ProxyScalingDown string = "ProxyScalingDown"
 	Decommissioning  string = "Decommissioning"
 	Unhealthy        string = "Unhealthy"
+	RefreshedCerts   string = "RefreshedCerts"
 )
 
 type LoggingEventRecorder struct {
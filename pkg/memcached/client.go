@@ -0,0 +1,152 @@
+package memcached
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds dialing and every command round trip
+const DefaultTimeout = 2 * time.Second
+
+// Client talks the memcached text protocol to a single server
+type Client struct {
+	conn    net.Conn
+	rw      *bufio.ReadWriter
+	timeout time.Duration
+	// deadline is the one of the dial context, no command runs past it
+	deadline time.Time
+}
+
+// Dial connects to a memcached server, over TLS when tlsConfig is not nil. The commands are
+// bounded by the deadline of ctx as well
+func Dial(ctx context.Context, addr string, tlsConfig *tls.Config) (*Client, error) {
+	dialer := &net.Dialer{Timeout: DefaultTimeout}
+
+	var conn net.Conn
+	var err error
+	if tlsConfig != nil {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, _ := ctx.Deadline()
+	return &Client{
+		conn:     conn,
+		rw:       bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)),
+		timeout:  DefaultTimeout,
+		deadline: deadline,
+	}, nil
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// PeerCertificates returns the certificates served by the server, nil without TLS
+func (c *Client) PeerCertificates() []*x509.Certificate {
+	tlsConn, ok := c.conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	return tlsConn.ConnectionState().PeerCertificates
+}
+
+// Authenticate logs in with the ASCII auth file credentials, memcached expects them as
+// the value of a set command
+func (c *Client) Authenticate(username, password string) error {
+	credentials := username + " " + password
+	line, err := c.command(fmt.Sprintf("set auth 0 0 %d\r\n%s\r\n", len(credentials), credentials))
+	if err != nil {
+		return err
+	}
+	if line != "STORED" {
+		return fmt.Errorf("authentication failed: %s", line)
+	}
+	return nil
+}
+
+// RefreshCerts makes memcached reload its certificates from disk
+func (c *Client) RefreshCerts() error {
+	line, err := c.command("refresh_certs\r\n")
+	if err != nil {
+		return err
+	}
+	if line != "OK" {
+		return fmt.Errorf("refresh_certs failed: %s", line)
+	}
+	return nil
+}
+
+// Version returns the version the server reports
+func (c *Client) Version() (string, error) {
+	line, err := c.command("version\r\n")
+	if err != nil {
+		return "", err
+	}
+	version, found := strings.CutPrefix(line, "VERSION ")
+	if !found {
+		return "", fmt.Errorf("version failed: %s", line)
+	}
+	return version, nil
+}
+
+// Stats returns the general-purpose statistics of the server by name
+func (c *Client) Stats() (map[string]string, error) {
+	line, err := c.command("stats\r\n")
+	if err != nil {
+		return nil, err
+	}
+
+	stats := map[string]string{}
+	for line != "END" {
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 || fields[0] != "STAT" {
+			return nil, fmt.Errorf("stats failed: %s", line)
+		}
+		stats[fields[1]] = fields[2]
+
+		if line, err = c.readLine(); err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+// command sends a raw request and returns the first response line
+func (c *Client) command(request string) (string, error) {
+	deadline := time.Now().Add(c.timeout)
+	if !c.deadline.IsZero() && c.deadline.Before(deadline) {
+		deadline = c.deadline
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return "", err
+	}
+
+	if _, err := c.rw.WriteString(request); err != nil {
+		return "", err
+	}
+	if err := c.rw.Flush(); err != nil {
+		return "", err
+	}
+
+	return c.readLine()
+}
+
+func (c *Client) readLine() (string, error) {
+	line, err := c.rw.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
@@ -16,54 +17,224 @@ func (rc *ReconciliationContext) ProcessReconcile() (reconcile.Result, error) {
 
 	logger := rc.ReqLogger
 
-	podList, err := rc.listPods(map[string]string{
-		cachev1.MemcachedLabel: cachev1.MemcachedLabel,
-	})
+	podList, err := rc.listPods(selectorLabelsForMemcached(rc.Memcached.Name))
 	if err != nil {
 		logger.Error(err, "error listing all pods")
 	}
 	rc.memcachedPods = PodPtrsFromPodList(podList)
 
 	// Memcached
+	fmt.Println("====> Memcached Auth Secret")
+	if recResult := rc.CheckMemcachedAuthSecret(); recResult.Completed() {
+		return recResult.Output()
+	}
+
+	fmt.Println("====> Memcached SASL ConfigMap")
+	if recResult := rc.CheckMemcachedSASLConfigMap(); recResult.Completed() {
+		return recResult.Output()
+	}
+
+	fmt.Println("====> Memcached Certificate")
+	if recResult := rc.CheckMemcachedCertificate(); recResult.Completed() {
+		return recResult.Output()
+	}
+
+	fmt.Println("====> Memcached TLS Secret")
+	if recResult := rc.CheckMemcachedTLSSecret(); recResult.Completed() {
+		return recResult.Output()
+	}
+
 	fmt.Println("====> Memcached Deployment")
 	if recResult := rc.CheckMemcachedDeploymentCreation(); recResult.Completed() {
 		return recResult.Output()
 	}
 
+	fmt.Println("====> Memcached StatefulSet")
+	if recResult := rc.CheckMemcachedStatefulSetCreation(); recResult.Completed() {
+		return recResult.Output()
+	}
+
+	fmt.Println("====> Memcached Secret Rollout")
+	if recResult := rc.CheckMemcachedSecretRollout(); recResult.Completed() {
+		return recResult.Output()
+	}
+
+	fmt.Println("====> Memcached Deployment Drift")
+	if recResult := rc.CheckMemcachedDeploymentDrift(); recResult.Completed() {
+		return recResult.Output()
+	}
+
+	fmt.Println("====> Memcached StatefulSet Drift")
+	if recResult := rc.CheckMemcachedStatefulSetDrift(); recResult.Completed() {
+		return recResult.Output()
+	}
+
+	fmt.Println("====> Memcached Scale Status")
+	if recResult := rc.CheckMemcachedScaleStatus(); recResult.Completed() {
+		return recResult.Output()
+	}
+
+	fmt.Println("====> Memcached Headless Service")
+	if recResult := rc.CheckMemcachedHeadlessServiceCreation(); recResult.Completed() {
+		return recResult.Output()
+	}
+
+	fmt.Println("====> Memcached Headless Service Drift")
+	if recResult := rc.CheckMemcachedHeadlessServiceDrift(); recResult.Completed() {
+		return recResult.Output()
+	}
+
+	fmt.Println("====> Memcached Topology Cleanup")
+	if recResult := rc.CheckMemcachedTopologyCleanup(); recResult.Completed() {
+		return recResult.Output()
+	}
+
 	fmt.Println("====> Memcached Service")
 	if recResult := rc.CheckMemcachedServiceCreation(); recResult.Completed() {
 		return recResult.Output()
 	}
 
-	fmt.Println("====> Memcached Deployment Scaling")
-	if recResult := rc.CheckMemcachedDeploymentScaling(); recResult.Completed() {
+	fmt.Println("====> Memcached Service Drift")
+	if recResult := rc.CheckMemcachedServiceDrift(); recResult.Completed() {
+		return recResult.Output()
+	}
+
+	fmt.Println("====> Memcached Memory Status")
+	if recResult := rc.CheckMemcachedMemoryStatus(); recResult.Completed() {
+		return recResult.Output()
+	}
+
+	fmt.Println("====> Memcached Decommission")
+	if recResult := rc.CheckMemcachedDecommission(); recResult.Completed() {
 		return recResult.Output()
 	}
 
 	// Proxy
+	fmt.Println("====> Proxy ConfigMap")
+	if recResult := rc.CheckProxyConfigMapCreation(); recResult.Completed() {
+		return recResult.Output()
+	}
+
 	fmt.Println("====> Proxy Deployment")
 	if recResult := rc.CheckProxyDeploymentCreation(); recResult.Completed() {
 		return recResult.Output()
 	}
 
+	fmt.Println("====> Proxy Config Rollout")
+	if recResult := rc.CheckProxyConfigRollout(); recResult.Completed() {
+		return recResult.Output()
+	}
+
+	fmt.Println("====> Proxy Deployment Drift")
+	if recResult := rc.CheckProxyDeploymentDrift(); recResult.Completed() {
+		return recResult.Output()
+	}
+
 	fmt.Println("====> Proxy Service")
 	if recResult := rc.CheckProxyServiceCreation(); recResult.Completed() {
 		return recResult.Output()
 	}
 
+	fmt.Println("====> Proxy Service Drift")
+	if recResult := rc.CheckProxyServiceDrift(); recResult.Completed() {
+		return recResult.Output()
+	}
+
+	fmt.Println("====> Proxy Headless Service")
+	if recResult := rc.CheckProxyHeadlessService(); recResult.Completed() {
+		return recResult.Output()
+	}
+
 	fmt.Println("====> Proxy Deployment Scaling")
 	if recResult := rc.CheckProxyDeploymentScaling(); recResult.Completed() {
 		return recResult.Output()
 	}
 
+	fmt.Println("====> Proxy PodDisruptionBudget")
+	if recResult := rc.CheckProxyPodDisruptionBudget(); recResult.Completed() {
+		return recResult.Output()
+	}
+
+	fmt.Println("====> Proxy Enabled")
+	if recResult := rc.CheckProxyEnabled(); recResult.Completed() {
+		return recResult.Output()
+	}
+
+	fmt.Println("====> Proxy Teardown")
+	if recResult := rc.CheckProxyTeardown(); recResult.Completed() {
+		return recResult.Output()
+	}
+
+	fmt.Println("====> Memcached Stats")
+	if recResult := rc.CheckMemcachedStats(); recResult.Completed() {
+		return recResult.Output()
+	}
+
+	fmt.Println("====> Memcached Conditions")
+	if recResult := rc.CheckMemcachedConditions(); recResult.Completed() {
+		return recResult.Output()
+	}
+
+	fmt.Println("====> Memcached Status")
+	if recResult := rc.CheckMemcachedStatus(); recResult.Completed() {
+		return recResult.Output()
+	}
+
+	// The proxy pool has dropped the departing pods by now
+	fmt.Println("====> Memcached Deployment Scaling")
+	if recResult := rc.CheckMemcachedDeploymentScaling(); recResult.Completed() {
+		return recResult.Output()
+	}
+
+	fmt.Println("====> Memcached PodDisruptionBudget")
+	if recResult := rc.CheckMemcachedPodDisruptionBudget(); recResult.Completed() {
+		return recResult.Output()
+	}
+
+	fmt.Println("====> Memcached Monitoring")
+	if recResult := rc.CheckMemcachedMonitoring(); recResult.Completed() {
+		return recResult.Output()
+	}
+
+	fmt.Println("====> Memcached TLS Refresh")
+	if recResult := rc.CheckMemcachedTLSRefresh(); recResult.Completed() {
+		return recResult.Output()
+	}
+
+	fmt.Println("====> Proxy Ramp-Up")
+	if recResult := rc.CheckProxyRampUp(); recResult.Completed() {
+		return recResult.Output()
+	}
+
 	// -------------------------------------------------------------------------
+	// A deletion waits on the decommission, come back to remove the finalizer
+	if rc.Memcached.GetDeletionTimestamp() != nil {
+		return RequeueSoon(1).Output()
+	}
+
 	if err := setOperatorProgressStatus(rc, cachev1.ProgressReady); err != nil {
 		return Error(err).Output()
 	}
 
+	if err := setObservedGeneration(rc); err != nil {
+		return Error(err).Output()
+	}
+
 	rc.ReqLogger.Info(podList.String())
 	rc.ReqLogger.Info("All Staff should now be reconciled.")
 
+	// Come back for the next stats poll, or earlier when a step asked for it
+	if rc.Memcached.Spec.Stats.Enable && !rc.textProtocolDisabled() {
+		wait := rc.statsPollWait()
+		if wait == 0 {
+			wait = rc.Memcached.Spec.StatsInterval()
+		}
+		rc.requeueWithin(wait)
+	}
+	if rc.requeueWait > 0 {
+		return requeueAfter(rc.requeueWait).Output()
+	}
+
 	return DoneReconsile().Output()
 }
 
@@ -81,16 +252,24 @@ func (rc *ReconciliationContext) ProcessDeletion() ReconcileResult {
 		return Error(err)
 	}
 
-	origSize := rc.Memcached.Spec.Size
 	if rc.Memcached.Status.GetConditionStatus(
 		cachev1.MemcacheDecommission,
-	) == corev1.ConditionTrue {
-		rc.Memcached.Spec.Size = 0
+	) != metav1.ConditionTrue {
+		if err := setCondition(rc, cachev1.MemcacheDecommission, metav1.ConditionTrue, "Deleting",
+			"Draining the memcached pods before the deletion"); err != nil {
+			return Error(err)
+		}
+	}
+
+	podList, err := rc.listPods(selectorLabelsForMemcached(rc.Memcached.Name))
+	if err != nil {
+		return Error(err)
 	}
 
+	// The reconcile goes on with 0 desired replicas, see desiredMemcachedReplicas
 	if rc.Memcached.Status.GetConditionStatus(
 		cachev1.MemcachedScalingDown,
-	) == corev1.ConditionTrue {
+	) == metav1.ConditionTrue || len(podList.Items) != 0 {
 		// ScalingDown is still happening
 		rc.Recorder.Eventf(
 			rc.Memcached,
@@ -103,7 +282,6 @@ func (rc *ReconciliationContext) ProcessDeletion() ReconcileResult {
 	}
 
 	rc.Memcached.SetFinalizers(nil)
-	rc.Memcached.Spec.Size = origSize // Has to be set to original size, since 0 isn't allowed for the Update to succeed
 
 	if err := rc.Client.Update(rc.Ctx, rc.Memcached); err != nil {
 		return Error(err)
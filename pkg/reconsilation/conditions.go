@@ -0,0 +1,235 @@
+package reconsilation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+)
+
+// unhealthyWaitingReasons are the container waiting reasons a pod doesn't get out of by itself
+var unhealthyWaitingReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+// workloadState is the rollout state of the memcached Deployment or StatefulSet
+type workloadState struct {
+	// replicas is the spec, the other counts come from the status
+	replicas   int32
+	current    int32
+	ready      int32
+	available  int32
+	updated    int32
+	rollingOut bool
+}
+
+func (rc *ReconciliationContext) memcachedWorkloadState() (workloadState, bool) {
+	if sts := rc.memcachedStatefulSet; sts != nil {
+		return workloadState{
+			replicas:  *sts.Spec.Replicas,
+			current:   sts.Status.Replicas,
+			ready:     sts.Status.ReadyReplicas,
+			available: sts.Status.AvailableReplicas,
+			updated:   sts.Status.UpdatedReplicas,
+			rollingOut: sts.Status.Replicas > 0 &&
+				sts.Status.UpdateRevision != "" &&
+				sts.Status.CurrentRevision != sts.Status.UpdateRevision,
+		}, true
+	}
+	if dep := rc.memcachedDeployment; dep != nil {
+		return workloadState{
+			replicas:   *dep.Spec.Replicas,
+			current:    dep.Status.Replicas,
+			ready:      dep.Status.ReadyReplicas,
+			available:  dep.Status.AvailableReplicas,
+			updated:    dep.Status.UpdatedReplicas,
+			rollingOut: dep.Status.Replicas > 0 && dep.Status.UpdatedReplicas < dep.Status.Replicas,
+		}, true
+	}
+	return workloadState{}, false
+}
+
+// unhealthyPodReason returns why a pod can't become ready on its own, empty when it can
+func unhealthyPodReason(pod *corev1.Pod) string {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled &&
+			condition.Status == corev1.ConditionFalse &&
+			condition.Reason == corev1.PodReasonUnschedulable {
+			return corev1.PodReasonUnschedulable
+		}
+	}
+
+	for _, statuses := range [][]corev1.ContainerStatus{
+		pod.Status.InitContainerStatuses,
+		pod.Status.ContainerStatuses,
+	} {
+		for _, status := range statuses {
+			if status.State.Waiting != nil && unhealthyWaitingReasons[status.State.Waiting.Reason] {
+				return status.State.Waiting.Reason
+			}
+		}
+	}
+
+	return ""
+}
+
+// proxyReadiness returns the ready and desired proxy replicas, both 0 with the proxy disabled
+func (rc *ReconciliationContext) proxyReadiness() (int32, int32) {
+	if !rc.Memcached.Spec.Proxy.Enable {
+		return 0, 0
+	}
+	if rc.proxyDeployment == nil {
+		return 0, rc.Memcached.Spec.Proxy.Replicas
+	}
+	return rc.proxyDeployment.Status.ReadyReplicas, rc.Memcached.Spec.Proxy.Replicas
+}
+
+// proxyRollingOut tells whether the proxy Deployment is still replacing pods
+func (rc *ReconciliationContext) proxyRollingOut() bool {
+	dep := rc.proxyDeployment
+	return dep != nil && dep.Status.Replicas > 0 && dep.Status.UpdatedReplicas < dep.Status.Replicas
+}
+
+// CheckMemcachedConditions sets the Ready, Degraded, ScalingUp and Updating conditions from the
+// state of the workloads and pods, Degraded also follows the stats thresholds. ScalingDown and
+// Decommission follow the scale down and the deletion, see CheckMemcachedDecommission and
+// ProcessDeletion
+func (rc *ReconciliationContext) CheckMemcachedConditions() ReconcileResult {
+	state, found := rc.memcachedWorkloadState()
+	if !found {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[conditions] CheckMemcachedConditions")
+
+	desired := rc.desiredMemcachedReplicas()
+	deleting := rc.Memcached.GetDeletionTimestamp() != nil
+	proxyReady, proxyDesired := rc.proxyReadiness()
+
+	updating := metav1.Condition{
+		Type:    string(cachev1.MemcachedUpdating),
+		Status:  metav1.ConditionFalse,
+		Reason:  "UpToDate",
+		Message: "All pods run the current spec",
+	}
+	if state.rollingOut {
+		updating.Status = metav1.ConditionTrue
+		updating.Reason = "RollingUpdate"
+		updating.Message = fmt.Sprintf("%d of %d memcached pods updated", state.updated, state.current)
+	} else if rc.proxyRollingOut() {
+		updating.Status = metav1.ConditionTrue
+		updating.Reason = "RollingUpdate"
+		updating.Message = fmt.Sprintf("%d of %d proxy pods updated",
+			rc.proxyDeployment.Status.UpdatedReplicas, rc.proxyDeployment.Status.Replicas)
+	}
+
+	scalingUp := metav1.Condition{
+		Type:    string(cachev1.MemcachedScalingUp),
+		Status:  metav1.ConditionFalse,
+		Reason:  "Scaled",
+		Message: fmt.Sprintf("%d memcached pods ready", state.ready),
+	}
+	if !deleting && !state.rollingOut && state.replicas <= desired && state.ready < desired {
+		scalingUp.Status = metav1.ConditionTrue
+		scalingUp.Reason = "ScalingUp"
+		scalingUp.Message = fmt.Sprintf("%d of %d memcached pods ready", state.ready, desired)
+	}
+
+	degraded := metav1.Condition{
+		Type:    string(cachev1.MemcachedDegraded),
+		Status:  metav1.ConditionFalse,
+		Reason:  "Healthy",
+		Message: "All pods are healthy",
+	}
+	var unhealthy []string
+	for _, pod := range rc.memcachedPods {
+		if reason := unhealthyPodReason(pod); reason != "" {
+			unhealthy = append(unhealthy, fmt.Sprintf("%s: %s", pod.Name, reason))
+		}
+	}
+	if len(unhealthy) != 0 {
+		sort.Strings(unhealthy)
+		degraded.Status = metav1.ConditionTrue
+		degraded.Reason = "PodsUnhealthy"
+		degraded.Message = strings.Join(unhealthy, ", ")
+	}
+	if stats := rc.Memcached.Status.Stats; stats != nil && len(stats.ThresholdsExceeded) != 0 {
+		exceeded := strings.Join(stats.ThresholdsExceeded, ", ")
+		if degraded.Status == metav1.ConditionTrue {
+			degraded.Message += "; " + exceeded
+		} else {
+			degraded.Status = metav1.ConditionTrue
+			degraded.Reason = "ThresholdsExceeded"
+			degraded.Message = exceeded
+		}
+	}
+
+	ready := metav1.Condition{
+		Type:    string(cachev1.MemcachedReady),
+		Status:  metav1.ConditionTrue,
+		Reason:  "Ready",
+		Message: fmt.Sprintf("All %d memcached pods are ready", desired),
+	}
+	switch {
+	case deleting:
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = "Decommissioning"
+		ready.Message = "Memcached is being deleted"
+	case state.ready < desired || state.rollingOut:
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = "PodsNotReady"
+		ready.Message = fmt.Sprintf("%d of %d memcached pods ready", state.ready, desired)
+	case proxyReady < proxyDesired:
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = "ProxyNotReady"
+		ready.Message = fmt.Sprintf("%d of %d proxy pods ready", proxyReady, proxyDesired)
+	}
+
+	if err := setConditions(rc, updating, scalingUp, degraded, ready); err != nil {
+		return Error(err)
+	}
+
+	return Continue()
+}
+
+// rolledOut tells whether the current generation runs everywhere: the conditions computed for it
+// report a ready Memcached that is neither updating nor scaling, and the workload controllers have
+// seen the latest workload specs
+func (rc *ReconciliationContext) rolledOut() bool {
+	generation := rc.Memcached.Generation
+
+	ready, found := rc.Memcached.GetCondition(cachev1.MemcachedReady)
+	if !found || ready.Status != metav1.ConditionTrue || ready.ObservedGeneration != generation {
+		return false
+	}
+	for _, conditionType := range []cachev1.MemcachedConditionType{
+		cachev1.MemcachedUpdating,
+		cachev1.MemcachedScalingUp,
+		cachev1.MemcachedScalingDown,
+	} {
+		if rc.Memcached.Status.GetConditionStatus(conditionType) == metav1.ConditionTrue {
+			return false
+		}
+	}
+
+	if sts := rc.memcachedStatefulSet; sts != nil && sts.Status.ObservedGeneration < sts.Generation {
+		return false
+	}
+	if dep := rc.memcachedDeployment; dep != nil && dep.Status.ObservedGeneration < dep.Generation {
+		return false
+	}
+	if dep := rc.proxyDeployment; dep != nil && dep.Status.ObservedGeneration < dep.Generation {
+		return false
+	}
+
+	return true
+}
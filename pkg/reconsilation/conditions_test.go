@@ -0,0 +1,219 @@
+package reconsilation
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+)
+
+// workloadDeployment returns a Deployment with spec replicas and the status counts
+func workloadDeployment(replicas, current, ready, updated int32) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		Spec: appsv1.DeploymentSpec{Replicas: &replicas},
+		Status: appsv1.DeploymentStatus{
+			Replicas:        current,
+			ReadyReplicas:   ready,
+			UpdatedReplicas: updated,
+		},
+	}
+}
+
+func waitingPod(name, reason string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{{
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason}},
+			}},
+		},
+	}
+}
+
+func unschedulablePod(name string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.PodStatus{
+			Conditions: []corev1.PodCondition{{
+				Type:   corev1.PodScheduled,
+				Status: corev1.ConditionFalse,
+				Reason: corev1.PodReasonUnschedulable,
+			}},
+		},
+	}
+}
+
+// conditionsCase is the state CheckMemcachedConditions runs against
+type conditionsCase struct {
+	size       int32
+	deployment *appsv1.Deployment
+	proxy      *appsv1.Deployment
+	pods       []*corev1.Pod
+	deleting   bool
+	exceeded   []string
+}
+
+// expectedConditions are the reasons of the Ready, Updating, ScalingUp and Degraded conditions
+type expectedConditions struct {
+	ready, updating, scalingUp, degraded string
+	degradedMessage                      string
+}
+
+var _ = Describe("Conditions", func() {
+	DescribeTable("Should set the conditions from the workloads and pods",
+		func(c conditionsCase, expected expectedConditions) {
+			m := &cachev1.Memcached{Spec: cachev1.MemcachedSpec{Size: c.size}}
+			if c.proxy != nil {
+				m.Spec.Proxy = cachev1.Proxy{Enable: true, Replicas: *c.proxy.Spec.Replicas}
+			}
+			if c.deleting {
+				m.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+				m.Finalizers = []string{"cache.bsod.io/finalizer"}
+			}
+			if c.exceeded != nil {
+				m.Status.Stats = &cachev1.StatsStatus{ThresholdsExceeded: c.exceeded}
+			}
+			rc := newTestContext(m)
+			rc.memcachedDeployment = c.deployment
+			rc.proxyDeployment = c.proxy
+			rc.memcachedPods = c.pods
+
+			Expect(rc.CheckMemcachedConditions().Completed()).To(BeFalse())
+
+			reason := func(conditionType cachev1.MemcachedConditionType) string {
+				condition, found := rc.Memcached.GetCondition(conditionType)
+				Expect(found).To(BeTrue())
+				return condition.Reason
+			}
+			Expect(reason(cachev1.MemcachedReady)).To(Equal(expected.ready))
+			Expect(reason(cachev1.MemcachedUpdating)).To(Equal(expected.updating))
+			Expect(reason(cachev1.MemcachedScalingUp)).To(Equal(expected.scalingUp))
+			Expect(reason(cachev1.MemcachedDegraded)).To(Equal(expected.degraded))
+			if expected.degradedMessage != "" {
+				condition, _ := rc.Memcached.GetCondition(cachev1.MemcachedDegraded)
+				Expect(condition.Message).To(Equal(expected.degradedMessage))
+			}
+		},
+		Entry("all pods ready", conditionsCase{
+			size:       3,
+			deployment: workloadDeployment(3, 3, 3, 3),
+		}, expectedConditions{
+			ready: "Ready", updating: "UpToDate", scalingUp: "Scaled", degraded: "Healthy",
+		}),
+		Entry("scaling up", conditionsCase{
+			size:       5,
+			deployment: workloadDeployment(5, 5, 3, 5),
+		}, expectedConditions{
+			ready: "PodsNotReady", updating: "UpToDate", scalingUp: "ScalingUp", degraded: "Healthy",
+		}),
+		Entry("rolling update, not scaling up", conditionsCase{
+			size:       3,
+			deployment: workloadDeployment(3, 4, 2, 1),
+		}, expectedConditions{
+			ready: "PodsNotReady", updating: "RollingUpdate", scalingUp: "Scaled", degraded: "Healthy",
+		}),
+		Entry("crash looping pod", conditionsCase{
+			size:       2,
+			deployment: workloadDeployment(2, 2, 1, 2),
+			pods:       []*corev1.Pod{waitingPod("cache-b", "CrashLoopBackOff"), waitingPod("cache-a", "ContainerCreating")},
+		}, expectedConditions{
+			ready: "PodsNotReady", updating: "UpToDate", scalingUp: "ScalingUp", degraded: "PodsUnhealthy",
+			degradedMessage: "cache-b: CrashLoopBackOff",
+		}),
+		Entry("unschedulable pod with a threshold crossed", conditionsCase{
+			size:       2,
+			deployment: workloadDeployment(2, 2, 1, 2),
+			pods:       []*corev1.Pod{unschedulablePod("cache-a")},
+			exceeded:   []string{"12 connections above 10"},
+		}, expectedConditions{
+			ready: "PodsNotReady", updating: "UpToDate", scalingUp: "ScalingUp", degraded: "PodsUnhealthy",
+			degradedMessage: "cache-a: Unschedulable; 12 connections above 10",
+		}),
+		Entry("threshold crossed", conditionsCase{
+			size:       1,
+			deployment: workloadDeployment(1, 1, 1, 1),
+			exceeded:   []string{"hit ratio 40.0% below 80%"},
+		}, expectedConditions{
+			ready: "Ready", updating: "UpToDate", scalingUp: "Scaled", degraded: "ThresholdsExceeded",
+			degradedMessage: "hit ratio 40.0% below 80%",
+		}),
+		Entry("proxy not ready", conditionsCase{
+			size:       2,
+			deployment: workloadDeployment(2, 2, 2, 2),
+			proxy:      workloadDeployment(2, 2, 1, 2),
+		}, expectedConditions{
+			ready: "ProxyNotReady", updating: "UpToDate", scalingUp: "Scaled", degraded: "Healthy",
+		}),
+		Entry("proxy rolling update", conditionsCase{
+			size:       2,
+			deployment: workloadDeployment(2, 2, 2, 2),
+			proxy:      workloadDeployment(2, 3, 2, 1),
+		}, expectedConditions{
+			ready: "Ready", updating: "RollingUpdate", scalingUp: "Scaled", degraded: "Healthy",
+		}),
+		Entry("deleting", conditionsCase{
+			size:       3,
+			deployment: workloadDeployment(3, 3, 3, 3),
+			deleting:   true,
+		}, expectedConditions{
+			ready: "Decommissioning", updating: "UpToDate", scalingUp: "Scaled", degraded: "Healthy",
+		}),
+	)
+
+	DescribeTable("Should tell why a pod can't become ready on its own",
+		func(pod *corev1.Pod, expected string) {
+			Expect(unhealthyPodReason(pod)).To(Equal(expected))
+		},
+		Entry("healthy", &corev1.Pod{}, ""),
+		Entry("starting", waitingPod("cache", "ContainerCreating"), ""),
+		Entry("crash looping", waitingPod("cache", "CrashLoopBackOff"), "CrashLoopBackOff"),
+		Entry("image pull failing", waitingPod("cache", "ImagePullBackOff"), "ImagePullBackOff"),
+		Entry("unschedulable", unschedulablePod("cache"), "Unschedulable"),
+		Entry("init container failing", &corev1.Pod{Status: corev1.PodStatus{
+			InitContainerStatuses: []corev1.ContainerStatus{{
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CreateContainerConfigError"}},
+			}},
+		}}, "CreateContainerConfigError"),
+	)
+
+	DescribeTable("Should only report a rollout once the generation runs everywhere",
+		func(conditions []metav1.Condition, deployment *appsv1.Deployment, expected bool) {
+			m := &cachev1.Memcached{}
+			m.Generation = 2
+			m.Status.Conditions = conditions
+			rc := newTestContext(m)
+			rc.memcachedDeployment = deployment
+
+			Expect(rc.rolledOut()).To(Equal(expected))
+		},
+		Entry("ready", []metav1.Condition{
+			{Type: "Ready", Status: metav1.ConditionTrue, ObservedGeneration: 2},
+		}, &appsv1.Deployment{}, true),
+		Entry("ready for an older generation", []metav1.Condition{
+			{Type: "Ready", Status: metav1.ConditionTrue, ObservedGeneration: 1},
+		}, &appsv1.Deployment{}, false),
+		Entry("not ready", []metav1.Condition{
+			{Type: "Ready", Status: metav1.ConditionFalse, ObservedGeneration: 2},
+		}, &appsv1.Deployment{}, false),
+		Entry("updating", []metav1.Condition{
+			{Type: "Ready", Status: metav1.ConditionTrue, ObservedGeneration: 2},
+			{Type: "Updating", Status: metav1.ConditionTrue, ObservedGeneration: 2},
+		}, &appsv1.Deployment{}, false),
+		Entry("scaling down", []metav1.Condition{
+			{Type: "Ready", Status: metav1.ConditionTrue, ObservedGeneration: 2},
+			{Type: "ScalingDown", Status: metav1.ConditionTrue, ObservedGeneration: 2},
+		}, &appsv1.Deployment{}, false),
+		Entry("Deployment spec not seen yet", []metav1.Condition{
+			{Type: "Ready", Status: metav1.ConditionTrue, ObservedGeneration: 2},
+		}, &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Generation: 3},
+			Status:     appsv1.DeploymentStatus{ObservedGeneration: 2},
+		}, false),
+	)
+})
@@ -0,0 +1,418 @@
+package reconsilation
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+	"github.com/0x0BSoD/memcached-operator/pkg/events"
+)
+
+// podSpecOwnedFields and containerOwnedFields are fully generated by the operator, they are
+// compared exactly so values removed from the spec or added by hand count as drift. The other
+// fields are compared with DeepDerivative, only the values the operator sets are checked there.
+// The containers are listed so containersDrift always looks into them
+var (
+	podSpecOwnedFields = []string{
+		"initContainers",
+		"containers",
+		"volumes",
+		"nodeSelector",
+		"tolerations",
+		"affinity",
+		"topologySpreadConstraints",
+		"securityContext",
+		"priorityClassName",
+		"serviceAccountName",
+		"imagePullSecrets",
+	}
+	containerOwnedFields = []string{
+		"command",
+		"args",
+		"env",
+		"ports",
+		"resources",
+		"volumeMounts",
+		"livenessProbe",
+		"readinessProbe",
+		"startupProbe",
+	}
+)
+
+func (rc *ReconciliationContext) updateDeploymentIfDrifted(current, desired *appsv1.Deployment) ReconcileResult {
+	return rc.updateWorkloadIfDrifted(
+		"Deployment",
+		current,
+		current.Spec.Selector,
+		&current.Spec.Template,
+		desired.Labels,
+		desired.Spec.Template,
+	)
+}
+
+func (rc *ReconciliationContext) updateStatefulSetIfDrifted(current, desired *appsv1.StatefulSet) ReconcileResult {
+	return rc.updateWorkloadIfDrifted(
+		"StatefulSet",
+		current,
+		current.Spec.Selector,
+		&current.Spec.Template,
+		desired.Labels,
+		desired.Spec.Template,
+	)
+}
+
+// updateWorkloadIfDrifted patches the labels and the pod template of a Deployment or StatefulSet,
+// currentTemplate has to point into current
+func (rc *ReconciliationContext) updateWorkloadIfDrifted(
+	kind string,
+	current client.Object,
+	currentSelector *metav1.LabelSelector,
+	currentTemplate *corev1.PodTemplateSpec,
+	desiredLabels map[string]string,
+	desiredTemplate corev1.PodTemplateSpec,
+) ReconcileResult {
+	// The selector is immutable, keep the one the workload was created with
+	for k, v := range currentSelector.MatchLabels {
+		desiredTemplate.Labels[k] = v
+	}
+
+	drifted := workloadDrift(current.GetLabels(), *currentTemplate, desiredLabels, desiredTemplate)
+	if len(drifted) == 0 {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info(
+		kind+" drifted from the spec",
+		kind, current.GetName(),
+		"fields", drifted)
+
+	if err := setOperatorProgressStatus(rc, cachev1.ProgressUpdating); err != nil {
+		return Error(err)
+	}
+
+	patch := client.MergeFrom(current.DeepCopyObject().(client.Object))
+	current.SetLabels(mergeStringMaps(current.GetLabels(), desiredLabels))
+	// Keep annotations added by others (e.g. kubectl rollout restart) to avoid an extra rollout
+	desiredTemplate.Annotations = mergeStringMaps(
+		currentTemplate.Annotations,
+		desiredTemplate.Annotations,
+	)
+	*currentTemplate = desiredTemplate
+	if err := rc.Client.Patch(rc.Ctx, current, patch); err != nil {
+		return Error(err)
+	}
+
+	rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.DriftCorrected,
+		"Corrected drift in %s %s: %s", kind, current.GetName(), strings.Join(drifted, ", "))
+
+	return Continue()
+}
+
+func (rc *ReconciliationContext) updateServiceIfDrifted(current, desired *corev1.Service) ReconcileResult {
+	drifted := serviceDrift(current, desired)
+	if len(drifted) == 0 {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info(
+		"Service drifted from the spec",
+		"Service", current.Name,
+		"fields", drifted)
+
+	if err := setOperatorProgressStatus(rc, cachev1.ProgressUpdating); err != nil {
+		return Error(err)
+	}
+
+	patch := client.MergeFrom(current.DeepCopy())
+	current.Labels = mergeStringMaps(current.Labels, desired.Labels)
+	current.Spec.Selector = desired.Spec.Selector
+	current.Annotations = mergeStringMaps(current.Annotations, desired.Annotations)
+	current.Spec.Type = desired.Spec.Type
+	current.Spec.Ports = mergeServicePorts(current.Spec.Ports, desired.Spec.Ports, desired.Spec.Type)
+	current.Spec.PublishNotReadyAddresses = desired.Spec.PublishNotReadyAddresses
+	current.Spec.LoadBalancerSourceRanges = desired.Spec.LoadBalancerSourceRanges
+	// The API server defaults the traffic policies and IP families, only set ones are kept in line
+	if desired.Spec.ExternalTrafficPolicy != "" || desired.Spec.Type == corev1.ServiceTypeClusterIP {
+		current.Spec.ExternalTrafficPolicy = desired.Spec.ExternalTrafficPolicy
+	}
+	if desired.Spec.Type == corev1.ServiceTypeClusterIP {
+		current.Spec.HealthCheckNodePort = 0
+	}
+	if desired.Spec.InternalTrafficPolicy != nil {
+		current.Spec.InternalTrafficPolicy = desired.Spec.InternalTrafficPolicy
+	}
+	if len(desired.Spec.IPFamilies) != 0 {
+		current.Spec.IPFamilies = desired.Spec.IPFamilies
+	}
+	if desired.Spec.IPFamilyPolicy != nil {
+		current.Spec.IPFamilyPolicy = desired.Spec.IPFamilyPolicy
+	}
+	if err := rc.Client.Patch(rc.Ctx, current, patch); err != nil {
+		return Error(err)
+	}
+
+	rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.DriftCorrected,
+		"Corrected drift in Service %s: %s", current.Name, strings.Join(drifted, ", "))
+
+	return Continue()
+}
+
+func workloadDrift(
+	currentLabels map[string]string,
+	currentTemplate corev1.PodTemplateSpec,
+	desiredLabels map[string]string,
+	desiredTemplate corev1.PodTemplateSpec,
+) []string {
+	var drifted []string
+
+	if !equality.Semantic.DeepDerivative(desiredLabels, currentLabels) {
+		drifted = append(drifted, "metadata.labels")
+	}
+
+	return append(drifted, podTemplateDrift("spec.template", currentTemplate, desiredTemplate)...)
+}
+
+func podTemplateDrift(path string, current, desired corev1.PodTemplateSpec) []string {
+	var drifted []string
+
+	if !equality.Semantic.DeepDerivative(desired.Labels, current.Labels) {
+		drifted = append(drifted, path+".metadata.labels")
+	}
+	if !equality.Semantic.DeepDerivative(desired.Annotations, current.Annotations) {
+		drifted = append(drifted, path+".metadata.annotations")
+	}
+
+	currentSpec := normalizePodSpec(current.Spec)
+	desiredSpec := normalizePodSpec(desired.Spec)
+
+	for _, field := range fieldDrift(path+".spec", currentSpec, desiredSpec, podSpecOwnedFields...) {
+		switch field {
+		case path + ".spec.containers":
+			drifted = append(drifted, containersDrift(field, currentSpec.Containers, desiredSpec.Containers)...)
+		case path + ".spec.initContainers":
+			drifted = append(drifted, containersDrift(field, currentSpec.InitContainers, desiredSpec.InitContainers)...)
+		default:
+			drifted = append(drifted, field)
+		}
+	}
+
+	return drifted
+}
+
+// containersDrift narrows the drift down to the container fields when the containers are still the same ones
+func containersDrift(path string, current, desired []corev1.Container) []string {
+	if len(current) != len(desired) {
+		return []string{path}
+	}
+
+	var drifted []string
+	for idx := range desired {
+		if current[idx].Name != desired[idx].Name {
+			return []string{path}
+		}
+		containerPath := fmt.Sprintf("%s[%s]", path, desired[idx].Name)
+		drifted = append(drifted, fieldDrift(containerPath, current[idx], desired[idx], containerOwnedFields...)...)
+	}
+	return drifted
+}
+
+// normalizePodSpec returns a copy of the spec with the defaults the API server sets on the owned
+// fields filled in, so a template read back from the cluster compares equal to the generated one
+func normalizePodSpec(spec corev1.PodSpec) corev1.PodSpec {
+	normalized := *spec.DeepCopy()
+
+	if normalized.SecurityContext == nil {
+		normalized.SecurityContext = &corev1.PodSecurityContext{}
+	}
+
+	defaultMode := int32(corev1.SecretVolumeSourceDefaultMode)
+	for idx := range normalized.Volumes {
+		source := &normalized.Volumes[idx].VolumeSource
+		switch {
+		case source.Secret != nil && source.Secret.DefaultMode == nil:
+			source.Secret.DefaultMode = &defaultMode
+		case source.ConfigMap != nil && source.ConfigMap.DefaultMode == nil:
+			source.ConfigMap.DefaultMode = &defaultMode
+		case source.Projected != nil && source.Projected.DefaultMode == nil:
+			source.Projected.DefaultMode = &defaultMode
+		case source.DownwardAPI != nil && source.DownwardAPI.DefaultMode == nil:
+			source.DownwardAPI.DefaultMode = &defaultMode
+		case source.HostPath != nil && source.HostPath.Type == nil:
+			source.HostPath.Type = &[]corev1.HostPathType{corev1.HostPathUnset}[0]
+		case source.Ephemeral != nil && source.Ephemeral.VolumeClaimTemplate != nil &&
+			source.Ephemeral.VolumeClaimTemplate.Spec.VolumeMode == nil:
+			source.Ephemeral.VolumeClaimTemplate.Spec.VolumeMode =
+				&[]corev1.PersistentVolumeMode{corev1.PersistentVolumeFilesystem}[0]
+		}
+	}
+
+	for _, containers := range [][]corev1.Container{normalized.InitContainers, normalized.Containers} {
+		for idx := range containers {
+			normalizeContainer(&containers[idx])
+		}
+	}
+
+	return normalized
+}
+
+func normalizeContainer(container *corev1.Container) {
+	// A limit without a request makes the API server request the limit
+	for name, limit := range container.Resources.Limits {
+		if _, found := container.Resources.Requests[name]; !found {
+			if container.Resources.Requests == nil {
+				container.Resources.Requests = corev1.ResourceList{}
+			}
+			container.Resources.Requests[name] = limit.DeepCopy()
+		}
+	}
+
+	for idx := range container.Ports {
+		if container.Ports[idx].Protocol == "" {
+			container.Ports[idx].Protocol = corev1.ProtocolTCP
+		}
+	}
+
+	for idx := range container.Env {
+		if from := container.Env[idx].ValueFrom; from != nil && from.FieldRef != nil && from.FieldRef.APIVersion == "" {
+			from.FieldRef.APIVersion = "v1"
+		}
+	}
+
+	for _, probe := range []*corev1.Probe{container.LivenessProbe, container.ReadinessProbe, container.StartupProbe} {
+		if probe == nil {
+			continue
+		}
+		if probe.TimeoutSeconds == 0 {
+			probe.TimeoutSeconds = 1
+		}
+		if probe.PeriodSeconds == 0 {
+			probe.PeriodSeconds = 10
+		}
+		if probe.SuccessThreshold == 0 {
+			probe.SuccessThreshold = 1
+		}
+		if probe.FailureThreshold == 0 {
+			probe.FailureThreshold = 3
+		}
+		if probe.HTTPGet != nil && probe.HTTPGet.Scheme == "" {
+			probe.HTTPGet.Scheme = corev1.URISchemeHTTP
+		}
+	}
+}
+
+func serviceDrift(current, desired *corev1.Service) []string {
+	var drifted []string
+
+	if !equality.Semantic.DeepDerivative(desired.Labels, current.Labels) {
+		drifted = append(drifted, "metadata.labels")
+	}
+	if !equality.Semantic.DeepDerivative(desired.Annotations, current.Annotations) {
+		drifted = append(drifted, "metadata.annotations")
+	}
+
+	for _, field := range fieldDrift("spec", current.Spec, desired.Spec) {
+		if field != "spec.selector" {
+			drifted = append(drifted, field)
+		}
+	}
+	// DeepDerivative ignores extra ports, a port that is no longer wanted has to go
+	if len(current.Spec.Ports) > len(desired.Spec.Ports) {
+		drifted = append(drifted, "spec.ports")
+	}
+	// DeepDerivative skips unset fields, settings that were turned off have to be caught here
+	if len(desired.Spec.LoadBalancerSourceRanges) == 0 && len(current.Spec.LoadBalancerSourceRanges) != 0 {
+		drifted = append(drifted, "spec.loadBalancerSourceRanges")
+	}
+	if !desired.Spec.PublishNotReadyAddresses && current.Spec.PublishNotReadyAddresses {
+		drifted = append(drifted, "spec.publishNotReadyAddresses")
+	}
+	// A selector with extra keys selects other pods, so it has to match exactly
+	if !equality.Semantic.DeepEqual(desired.Spec.Selector, current.Spec.Selector) {
+		drifted = append(drifted, "spec.selector")
+	}
+
+	return drifted
+}
+
+// fieldDrift lists the json paths of the fields current does not match, both values have to be
+// structs of the same type. The exact fields have to be equal, the others only have to match the
+// values set in desired
+func fieldDrift(path string, current, desired interface{}, exact ...string) []string {
+	currentValue := reflect.ValueOf(current)
+	desiredValue := reflect.ValueOf(desired)
+	t := desiredValue.Type()
+
+	isExact := make(map[string]bool, len(exact))
+	for _, name := range exact {
+		isExact[name] = true
+	}
+
+	var drifted []string
+	for i := 0; i < t.NumField(); i++ {
+		if !t.Field(i).IsExported() {
+			continue
+		}
+
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			name = t.Field(i).Name
+		}
+
+		desiredField := desiredValue.Field(i).Interface()
+		currentField := currentValue.Field(i).Interface()
+		if isExact[name] {
+			if equality.Semantic.DeepEqual(desiredField, currentField) {
+				continue
+			}
+		} else if equality.Semantic.DeepDerivative(desiredField, currentField) {
+			continue
+		}
+
+		drifted = append(drifted, fmt.Sprintf("%s.%s", path, name))
+	}
+	return drifted
+}
+
+func mergeStringMaps(current, desired map[string]string) map[string]string {
+	merged := make(map[string]string, len(current)+len(desired))
+	for k, v := range current {
+		merged[k] = v
+	}
+	for k, v := range desired {
+		merged[k] = v
+	}
+	return merged
+}
+
+// mergeServicePorts keeps the allocated node ports of the current ports that still exist,
+// a ClusterIP Service can't have any
+func mergeServicePorts(current, desired []corev1.ServicePort, serviceType corev1.ServiceType) []corev1.ServicePort {
+	nodePorts := make(map[string]int32, len(current))
+	if serviceType != corev1.ServiceTypeClusterIP {
+		for _, port := range current {
+			nodePorts[fmt.Sprintf("%s/%s", port.Name, port.Protocol)] = port.NodePort
+		}
+	}
+
+	merged := make([]corev1.ServicePort, 0, len(desired))
+	for _, port := range desired {
+		protocol := port.Protocol
+		if protocol == "" {
+			protocol = corev1.ProtocolTCP
+		}
+		if port.NodePort == 0 {
+			port.NodePort = nodePorts[fmt.Sprintf("%s/%s", port.Name, protocol)]
+		}
+		merged = append(merged, port)
+	}
+	return merged
+}
@@ -0,0 +1,141 @@
+package reconsilation
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func driftTemplate() corev1.PodTemplateSpec {
+	return corev1.PodTemplateSpec{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:  "memcached",
+				Image: "memcached:1.6.23-alpine",
+				Args:  []string{"-m=64", "-v"},
+				Ports: []corev1.ContainerPort{{Name: "memcached", ContainerPort: 11211}},
+				Resources: corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi")},
+				},
+				VolumeMounts: []corev1.VolumeMount{{
+					Name:      "auth",
+					MountPath: "/etc/memcached/auth",
+				}},
+				LivenessProbe: &corev1.Probe{
+					ProbeHandler: corev1.ProbeHandler{
+						TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt32(11211)},
+					},
+				},
+			}},
+			Volumes: []corev1.Volume{{
+				Name: "auth",
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{SecretName: "auth"},
+				},
+			}},
+			Tolerations: []corev1.Toleration{{
+				Key:      "dedicated",
+				Operator: corev1.TolerationOpEqual,
+				Value:    "cache",
+				Effect:   corev1.TaintEffectNoSchedule,
+			}},
+		},
+	}
+}
+
+// apiServerDefaults fills in what the API server adds to a stored template
+func apiServerDefaults(template corev1.PodTemplateSpec) corev1.PodTemplateSpec {
+	stored := *template.DeepCopy()
+	spec := &stored.Spec
+	spec.SecurityContext = &corev1.PodSecurityContext{}
+	spec.RestartPolicy = corev1.RestartPolicyAlways
+	spec.DNSPolicy = corev1.DNSClusterFirst
+	for idx := range spec.Volumes {
+		if secret := spec.Volumes[idx].Secret; secret != nil {
+			secret.DefaultMode = &[]int32{0644}[0]
+		}
+	}
+	for idx := range spec.Containers {
+		container := &spec.Containers[idx]
+		container.TerminationMessagePath = corev1.TerminationMessagePathDefault
+		container.ImagePullPolicy = corev1.PullIfNotPresent
+		for name, limit := range container.Resources.Limits {
+			if container.Resources.Requests == nil {
+				container.Resources.Requests = corev1.ResourceList{}
+			}
+			container.Resources.Requests[name] = limit
+		}
+		for p := range container.Ports {
+			container.Ports[p].Protocol = corev1.ProtocolTCP
+		}
+		if probe := container.LivenessProbe; probe != nil {
+			probe.TimeoutSeconds = 1
+			probe.PeriodSeconds = 10
+			probe.SuccessThreshold = 1
+			probe.FailureThreshold = 3
+		}
+	}
+	return stored
+}
+
+var _ = Describe("Drift", func() {
+	It("Should not report the API server defaults", func() {
+		desired := driftTemplate()
+		Expect(podTemplateDrift("spec.template", apiServerDefaults(desired), desired)).To(BeEmpty())
+	})
+
+	DescribeTable("Should report the owned fields that don't match exactly",
+		func(change func(desired, current *corev1.PodTemplateSpec), expected string) {
+			desired := driftTemplate()
+			current := apiServerDefaults(desired)
+			change(&desired, &current)
+
+			Expect(podTemplateDrift("spec.template", current, desired)).To(ConsistOf(expected))
+		},
+		Entry("an arg removed from the spec", func(desired, _ *corev1.PodTemplateSpec) {
+			desired.Spec.Containers[0].Args = []string{"-m=64"}
+		}, "spec.template.spec.containers[memcached].args"),
+		Entry("an arg added by hand", func(_, current *corev1.PodTemplateSpec) {
+			current.Spec.Containers[0].Args = append(current.Spec.Containers[0].Args, "-c=4096")
+		}, "spec.template.spec.containers[memcached].args"),
+		Entry("an env var added by hand", func(_, current *corev1.PodTemplateSpec) {
+			current.Spec.Containers[0].Env = []corev1.EnvVar{{Name: "DEBUG", Value: "1"}}
+		}, "spec.template.spec.containers[memcached].env"),
+		Entry("a volume removed from the spec", func(desired, _ *corev1.PodTemplateSpec) {
+			desired.Spec.Volumes = nil
+		}, "spec.template.spec.volumes"),
+		Entry("a toleration removed from the spec", func(desired, _ *corev1.PodTemplateSpec) {
+			desired.Spec.Tolerations = nil
+		}, "spec.template.spec.tolerations"),
+		Entry("a probe turned off", func(desired, _ *corev1.PodTemplateSpec) {
+			desired.Spec.Containers[0].LivenessProbe = nil
+		}, "spec.template.spec.containers[memcached].livenessProbe"),
+		Entry("a limit changed by hand", func(_, current *corev1.PodTemplateSpec) {
+			current.Spec.Containers[0].Resources.Limits[corev1.ResourceMemory] = resource.MustParse("1Gi")
+		}, "spec.template.spec.containers[memcached].resources"),
+		Entry("a request added by hand", func(_, current *corev1.PodTemplateSpec) {
+			current.Spec.Containers[0].Resources.Requests[corev1.ResourceCPU] = resource.MustParse("500m")
+		}, "spec.template.spec.containers[memcached].resources"),
+		Entry("a priority class set by hand", func(_, current *corev1.PodTemplateSpec) {
+			current.Spec.PriorityClassName = "high-priority"
+		}, "spec.template.spec.priorityClassName"),
+		Entry("a service account set by hand", func(_, current *corev1.PodTemplateSpec) {
+			current.Spec.ServiceAccountName = "privileged"
+		}, "spec.template.spec.serviceAccountName"),
+		Entry("an image pull secret added by hand", func(_, current *corev1.PodTemplateSpec) {
+			current.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "registry"}}
+		}, "spec.template.spec.imagePullSecrets"),
+	)
+
+	It("Should ignore the fields the operator doesn't set", func() {
+		desired := driftTemplate()
+		current := apiServerDefaults(desired)
+		current.Spec.Containers[0].TerminationMessagePolicy = corev1.TerminationMessageReadFile
+		current.Spec.SchedulerName = "custom-scheduler"
+
+		Expect(podTemplateDrift("spec.template", current, desired)).To(BeEmpty())
+	})
+})
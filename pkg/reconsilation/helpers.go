@@ -1,16 +1,27 @@
 package reconsilation
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+
 	corev1 "k8s.io/api/core/v1"
 
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+	"github.com/0x0BSoD/memcached-operator/pkg/events"
 )
 
 func retrieveMemcaheds(rc *ReconciliationContext, request *reconcile.Request, dc *cachev1.Memcached) error {
@@ -31,9 +42,6 @@ func setOperatorProgressStatus(rc *ReconciliationContext, newState cachev1.Progr
 
 	patch := client.MergeFrom(rc.Memcached.DeepCopy())
 	rc.Memcached.Status.OperatorProgress = newState
-	if newState == cachev1.ProgressReady {
-		rc.Memcached.Status.ObservedGeneration = rc.Memcached.Generation
-	}
 	if err := rc.Client.Status().Patch(rc.Ctx, rc.Memcached, patch); err != nil {
 		rc.ReqLogger.Error(err, "error updating the Memcached Operator Progress state")
 		return err
@@ -42,6 +50,65 @@ func setOperatorProgressStatus(rc *ReconciliationContext, newState cachev1.Progr
 	return nil
 }
 
+func setCondition(
+	rc *ReconciliationContext,
+	conditionType cachev1.MemcachedConditionType,
+	status metav1.ConditionStatus,
+	reason, message string,
+) error {
+	rc.ReqLogger.Info("[reconcile] setCondition", "type", conditionType, "reason", reason)
+
+	return setConditions(rc, metav1.Condition{
+		Type:    string(conditionType),
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	})
+}
+
+// setConditions sets several conditions with a single status patch, each one records the
+// generation it was computed for
+func setConditions(rc *ReconciliationContext, conditions ...metav1.Condition) error {
+	patch := client.MergeFrom(rc.Memcached.DeepCopy())
+	changed := false
+	for _, condition := range conditions {
+		condition.ObservedGeneration = rc.Memcached.Generation
+		if rc.Memcached.Status.SetCondition(condition) {
+			changed = true
+		}
+	}
+	if !changed {
+		// early return, no need to ping k8s
+		return nil
+	}
+
+	if err := rc.Client.Status().Patch(rc.Ctx, rc.Memcached, patch); err != nil {
+		rc.ReqLogger.Error(err, "error updating the Memcached conditions")
+		return err
+	}
+
+	return nil
+}
+
+// setObservedGeneration advances status.observedGeneration once the current generation has rolled
+// out, see rolledOut
+func setObservedGeneration(rc *ReconciliationContext) error {
+	if rc.Memcached.Status.ObservedGeneration == rc.Memcached.Generation || !rc.rolledOut() {
+		return nil
+	}
+
+	rc.ReqLogger.Info("[reconcile] setObservedGeneration", "generation", rc.Memcached.Generation)
+
+	patch := client.MergeFrom(rc.Memcached.DeepCopy())
+	rc.Memcached.Status.ObservedGeneration = rc.Memcached.Generation
+	if err := rc.Client.Status().Patch(rc.Ctx, rc.Memcached, patch); err != nil {
+		rc.ReqLogger.Error(err, "error updating the Memcached observed generation")
+		return err
+	}
+
+	return nil
+}
+
 func (rc *ReconciliationContext) addFinalizer() error {
 	if _, found := rc.Memcached.Annotations[cachev1.NoFinalizerAnnotation]; found {
 		return nil
@@ -85,3 +152,193 @@ func PodPtrsFromPodList(podList *corev1.PodList) []*corev1.Pod {
 	}
 	return pods
 }
+
+func isPodReady(pod *corev1.Pod) bool {
+	if pod.GetDeletionTimestamp() != nil || pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// hashConfigMapData returns a stable digest of the ConfigMap data, used to roll pods on config changes
+func hashConfigMapData(data map[string]string) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write([]byte(data[k]))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashSecretData returns a stable digest of the Secret data
+func hashSecretData(secret *corev1.Secret) string {
+	data := make(map[string]string, len(secret.Data))
+	for k, v := range secret.Data {
+		data[k] = string(v)
+	}
+	return hashConfigMapData(data)
+}
+
+// kindExists reports whether the API server serves the kind, used for the optional CRDs of other
+// operators. The manager RESTMapper caches the kinds it found, a missing kind is looked up again
+// through discovery on every call
+func (rc *ReconciliationContext) kindExists(gvk schema.GroupVersionKind) (bool, error) {
+	_, err := rc.Client.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// optionalResourceCreated reports whether an object of the optional CRD kind was created for the
+// Memcached, see setOptionalResource
+func (rc *ReconciliationContext) optionalResourceCreated(kind string) bool {
+	for _, created := range rc.Memcached.Status.OptionalResources {
+		if created == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// setOptionalResource records in status whether an object of the optional CRD kind exists, so
+// the kind is only looked up for the cleanup once the feature is turned off
+func setOptionalResource(rc *ReconciliationContext, kind string, created bool) error {
+	if rc.optionalResourceCreated(kind) == created {
+		// early return, no need to ping k8s
+		return nil
+	}
+
+	kinds := []string{}
+	for _, k := range rc.Memcached.Status.OptionalResources {
+		if k != kind {
+			kinds = append(kinds, k)
+		}
+	}
+	if created {
+		kinds = append(kinds, kind)
+		sort.Strings(kinds)
+	}
+
+	patch := client.MergeFrom(rc.Memcached.DeepCopy())
+	rc.Memcached.Status.OptionalResources = kinds
+	if err := rc.Client.Status().Patch(rc.Ctx, rc.Memcached, patch); err != nil {
+		rc.ReqLogger.Error(err, "error updating the Memcached optional resources")
+		return err
+	}
+
+	return nil
+}
+
+// ownedObject names an object the Memcached may own, used when cleaning up
+type ownedObject struct {
+	kind string
+	name string
+	obj  client.Object
+}
+
+// deleteOwnedObject removes the named object if it exists and is controlled by the Memcached,
+// it reports whether a delete was issued
+func (rc *ReconciliationContext) deleteOwnedObject(obj client.Object, name string) (bool, error) {
+	err := rc.Client.Get(rc.Ctx,
+		types.NamespacedName{
+			Name:      name,
+			Namespace: rc.Memcached.Namespace,
+		}, obj)
+	if errors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if !metav1.IsControlledBy(obj, rc.Memcached) {
+		rc.ReqLogger.Info("Skipping delete of an object not owned by the Memcached", "name", name)
+		return false, nil
+	}
+
+	if err := rc.Client.Delete(rc.Ctx, obj); err != nil && !errors.IsNotFound(err) {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// applyUnstructured creates an object of an optional CRD, or brings the labels and spec of the
+// existing one back in line with desired
+func (rc *ReconciliationContext) applyUnstructured(desired *unstructured.Unstructured) error {
+	kind := desired.GetKind()
+
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(desired.GroupVersionKind())
+	err := rc.Client.Get(rc.Ctx,
+		types.NamespacedName{
+			Name:      desired.GetName(),
+			Namespace: desired.GetNamespace(),
+		}, current)
+	if errors.IsNotFound(err) {
+		if err := setOperatorProgressStatus(rc, cachev1.ProgressUpdating); err != nil {
+			return err
+		}
+
+		if err := rc.Client.Create(rc.Ctx, desired); err != nil {
+			return err
+		}
+
+		rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.CreatedResource,
+			"Created %s %s", kind, desired.GetName())
+		return nil
+	} else if err != nil {
+		rc.ReqLogger.Error(
+			err,
+			"Could not locate "+kind+" for",
+			"Memcached", rc.Memcached.Name)
+		return err
+	}
+
+	if equality.Semantic.DeepDerivative(desired.Object["spec"], current.Object["spec"]) &&
+		equality.Semantic.DeepDerivative(desired.GetLabels(), current.GetLabels()) {
+		return nil
+	}
+
+	patch := client.MergeFrom(current.DeepCopy())
+	current.SetLabels(mergeStringMaps(current.GetLabels(), desired.GetLabels()))
+	current.Object["spec"] = desired.Object["spec"]
+	if err := rc.Client.Patch(rc.Ctx, current, patch); err != nil {
+		return err
+	}
+
+	rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.DriftCorrected,
+		"Corrected drift in %s %s: spec", kind, current.GetName())
+
+	return nil
+}
+
+// deleteOwnedUnstructured removes an object of an optional CRD once the feature using it is turned off
+func (rc *ReconciliationContext) deleteOwnedUnstructured(gvk schema.GroupVersionKind, name string) error {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+
+	deleted, err := rc.deleteOwnedObject(obj, name)
+	if err != nil {
+		return err
+	}
+	if deleted {
+		rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.DeletedResource,
+			"Deleted %s %s", gvk.Kind, name)
+	}
+
+	return nil
+}
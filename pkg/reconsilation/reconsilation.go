@@ -2,6 +2,7 @@ package reconsilation
 
 import (
 	"context"
+	"time"
 
 	"github.com/go-logr/logr"
 
@@ -31,9 +32,20 @@ type ReconciliationContext struct {
 	// see: golang/go#22602
 	Ctx context.Context
 
-	memcachedPods       []*corev1.Pod
-	memcachedDeployment *appsv1.Deployment
-	proxyDeployment     *appsv1.Deployment
+	memcachedPods            []*corev1.Pod
+	memcachedDeployment      *appsv1.Deployment
+	memcachedStatefulSet     *appsv1.StatefulSet
+	memcachedService         *corev1.Service
+	memcachedHeadlessService *corev1.Service
+	memcachedAuthSecret      *corev1.Secret
+	memcachedTLSSecret       *corev1.Secret
+	proxyDeployment          *appsv1.Deployment
+	proxyService             *corev1.Service
+	proxyConfigMap           *corev1.ConfigMap
+
+	// requeueWait is the shortest wait a step asked for, the reconcile comes back after it once all
+	// of the steps have run
+	requeueWait time.Duration
 }
 
 func CreateReconciliationContext(
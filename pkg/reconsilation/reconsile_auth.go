@@ -0,0 +1,228 @@
+package reconsilation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+	"github.com/0x0BSoD/memcached-operator/pkg/events"
+)
+
+const (
+	authVolumeName       = "auth"
+	authMountPath        = "/etc/memcached/auth"
+	authFileName         = "auth"
+	saslConfigVolumeName = "sasl-config"
+	saslConfigMountPath  = "/etc/memcached/sasl"
+	// saslConfigFileName is read by cyrus-sasl from SASL_CONF_PATH, named after the application
+	saslConfigFileName = "memcached.conf"
+)
+
+func configMapNameForSASL(name string) string {
+	return fmt.Sprintf("%s-sasl-config", name)
+}
+
+func authSecretKey(auth cachev1.Auth) string {
+	if auth.SecretKey == "" {
+		return cachev1.DefaultAuthSecretKey
+	}
+	return auth.SecretKey
+}
+
+// hashAuthSecret returns a digest of the credentials, used to roll the pods when they change
+func hashAuthSecret(secret *corev1.Secret, key string) string {
+	sum := sha256.Sum256(secret.Data[key])
+	return hex.EncodeToString(sum[:])
+}
+
+func (rc *ReconciliationContext) configMapForSASL() (*corev1.ConfigMap, error) {
+	rc.ReqLogger.Info("[reconcile_auth] configMapForSASL")
+
+	image := imageForMemcached(rc.Memcached.Spec.Image)
+	ls := labelsForMemcached(rc.Memcached.Name, image)
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      configMapNameForSASL(rc.Memcached.Name),
+			Namespace: rc.Memcached.Namespace,
+			Labels:    ls,
+		},
+		Data: map[string]string{
+			// the password db given with MEMCACHED_SASL_PWDB only backs the PLAIN mechanism
+			saslConfigFileName: "mech_list: plain\n",
+		},
+	}
+
+	if err := ctrl.SetControllerReference(rc.Memcached, cm, rc.Scheme); err != nil {
+		return nil, err
+	}
+
+	return cm, nil
+}
+
+// addMemcachedAuth mounts the credentials into the memcached container of the template and
+// turns authentication on
+func (rc *ReconciliationContext) addMemcachedAuth(template *corev1.PodTemplateSpec) {
+	auth := rc.Memcached.Spec.Auth
+	if !auth.Enable {
+		return
+	}
+
+	// The Secret files are owned by root, the group lets the memcached user read them
+	template.Spec.SecurityContext.FSGroup = &[]int64{memcachedUID}[0]
+	template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+		Name: authVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: auth.SecretName,
+				Items: []corev1.KeyToPath{{
+					Key:  authSecretKey(auth),
+					Path: authFileName,
+				}},
+				DefaultMode: &[]int32{0440}[0],
+			},
+		},
+	})
+
+	container := &template.Spec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      authVolumeName,
+		MountPath: authMountPath,
+		ReadOnly:  true,
+	})
+
+	authFile := fmt.Sprintf("%s/%s", authMountPath, authFileName)
+	if auth.Mode != cachev1.AuthModeSASL {
+		container.Command = append(container.Command, "-Y", authFile)
+		return
+	}
+
+	template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+		Name: saslConfigVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: configMapNameForSASL(rc.Memcached.Name),
+				},
+			},
+		},
+	})
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      saslConfigVolumeName,
+		MountPath: saslConfigMountPath,
+		ReadOnly:  true,
+	})
+	container.Env = append(container.Env,
+		corev1.EnvVar{Name: "SASL_CONF_PATH", Value: saslConfigMountPath},
+		corev1.EnvVar{Name: "MEMCACHED_SASL_PWDB", Value: authFile},
+	)
+	container.Command = append(container.Command, "-S")
+}
+
+// CheckMemcachedAuthSecret loads the credentials Secret, the pods can't start without it
+func (rc *ReconciliationContext) CheckMemcachedAuthSecret() ReconcileResult {
+	auth := rc.Memcached.Spec.Auth
+	if !auth.Enable {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_auth] CheckMemcachedAuthSecret")
+
+	secret := &corev1.Secret{}
+	err := rc.Client.Get(rc.Ctx,
+		types.NamespacedName{
+			Name:      auth.SecretName,
+			Namespace: rc.Memcached.Namespace,
+		}, secret)
+	if err != nil {
+		rc.ReqLogger.Error(
+			err,
+			"Could not locate the auth Secret for",
+			"Memcached", rc.Memcached.Name)
+		return Error(err)
+	}
+
+	if _, found := secret.Data[authSecretKey(auth)]; !found {
+		return Error(fmt.Errorf("auth Secret %s has no %s key", secret.Name, authSecretKey(auth)))
+	}
+
+	rc.memcachedAuthSecret = secret
+
+	return Continue()
+}
+
+// CheckMemcachedSASLConfigMap keeps the generated SASL config while SASL is enabled and
+// removes it otherwise
+func (rc *ReconciliationContext) CheckMemcachedSASLConfigMap() ReconcileResult {
+	rc.ReqLogger.Info("[reconcile_auth] CheckMemcachedSASLConfigMap")
+
+	auth := rc.Memcached.Spec.Auth
+	if !auth.Enable || auth.Mode != cachev1.AuthModeSASL {
+		deleted, err := rc.deleteOwnedObject(&corev1.ConfigMap{}, configMapNameForSASL(rc.Memcached.Name))
+		if err != nil {
+			return Error(err)
+		}
+		if deleted {
+			rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.DeletedResource,
+				"Deleted ConfigMap %s", configMapNameForSASL(rc.Memcached.Name))
+		}
+		return Continue()
+	}
+
+	desiredConfigMap, err := rc.configMapForSASL()
+	if err != nil {
+		return Error(err)
+	}
+
+	currentConfigMap := &corev1.ConfigMap{}
+	err = rc.Client.Get(rc.Ctx,
+		types.NamespacedName{
+			Name:      desiredConfigMap.Name,
+			Namespace: rc.Memcached.Namespace,
+		}, currentConfigMap)
+	if errors.IsNotFound(err) {
+		if err := setOperatorProgressStatus(rc, cachev1.ProgressUpdating); err != nil {
+			return Error(err)
+		}
+
+		if err := rc.Client.Create(rc.Ctx, desiredConfigMap); err != nil {
+			return Error(err)
+		}
+
+		rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.CreatedResource,
+			"Created ConfigMap %s", desiredConfigMap.Name)
+		return Continue()
+	} else if err != nil {
+		rc.ReqLogger.Error(
+			err,
+			"Could not locate SASL ConfigMap for",
+			"Memcached", rc.Memcached.Name)
+		return Error(err)
+	}
+
+	if reflect.DeepEqual(currentConfigMap.Data, desiredConfigMap.Data) {
+		return Continue()
+	}
+
+	patch := client.MergeFrom(currentConfigMap.DeepCopy())
+	currentConfigMap.Data = desiredConfigMap.Data
+	if err := rc.Client.Patch(rc.Ctx, currentConfigMap, patch); err != nil {
+		return Error(err)
+	}
+
+	rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.DriftCorrected,
+		"Corrected drift in ConfigMap %s: data", currentConfigMap.Name)
+
+	return Continue()
+}
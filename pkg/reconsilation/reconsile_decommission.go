@@ -0,0 +1,202 @@
+package reconsilation
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+	"github.com/0x0BSoD/memcached-operator/pkg/events"
+)
+
+// podDeletionCostAnnotation ranks the pods a ReplicaSet removes on a scale down, lowest cost first
+const podDeletionCostAnnotation = "controller.kubernetes.io/pod-deletion-cost"
+
+// desiredMemcachedReplicas is Spec.Size, or 0 once the Memcached is being deleted so the pods
+// are drained before the finalizer goes
+func (rc *ReconciliationContext) desiredMemcachedReplicas() int32 {
+	if rc.Memcached.GetDeletionTimestamp() != nil {
+		return 0
+	}
+	return rc.Memcached.Spec.Size
+}
+
+func isPodDecommissioned(pod *corev1.Pod) bool {
+	_, found := pod.Annotations[cachev1.DecommissionAnnotation]
+	return found
+}
+
+// podOrdinal returns the ordinal of a StatefulSet pod, the suffix of its name
+func podOrdinal(pod *corev1.Pod) (int, bool) {
+	idx := strings.LastIndex(pod.Name, "-")
+	if idx < 0 {
+		return 0, false
+	}
+	ordinal, err := strconv.Atoi(pod.Name[idx+1:])
+	return ordinal, err == nil
+}
+
+// departingPods returns the pods a scale down to desired removes. The StatefulSet removes the
+// highest ordinals. The ReplicaSet removes the not ready pods first, then the ones with the lowest
+// deletion cost, so the pods already marked stay picked and the newest ones come next
+func (rc *ReconciliationContext) departingPods(desired int32) []*corev1.Pod {
+	var active []*corev1.Pod
+	for _, pod := range rc.memcachedPods {
+		if pod.GetDeletionTimestamp() == nil {
+			active = append(active, pod)
+		}
+	}
+
+	if rc.Memcached.Spec.Topology == cachev1.TopologyStatefulSet {
+		var departing []*corev1.Pod
+		for _, pod := range active {
+			if ordinal, ok := podOrdinal(pod); ok && ordinal >= int(desired) {
+				departing = append(departing, pod)
+			}
+		}
+		return departing
+	}
+
+	surplus := len(active) - int(desired)
+	if surplus <= 0 {
+		return nil
+	}
+
+	sort.SliceStable(active, func(i, j int) bool {
+		if ready := isPodReady(active[i]); ready != isPodReady(active[j]) {
+			return !ready
+		}
+		if marked := isPodDecommissioned(active[i]); marked != isPodDecommissioned(active[j]) {
+			return marked
+		}
+		if !active[i].CreationTimestamp.Equal(&active[j].CreationTimestamp) {
+			return active[j].CreationTimestamp.Before(&active[i].CreationTimestamp)
+		}
+		return active[i].Name < active[j].Name
+	})
+
+	return active[:surplus]
+}
+
+// drainRemaining returns how long the departing pods still have to drain
+func (rc *ReconciliationContext) drainRemaining(departing []*corev1.Pod) time.Duration {
+	var remaining time.Duration
+	for _, pod := range departing {
+		started, err := time.Parse(time.RFC3339, pod.Annotations[cachev1.DecommissionAnnotation])
+		if err != nil {
+			started = time.Now()
+		}
+		if left := time.Until(started.Add(rc.Memcached.Spec.DrainPeriod())); left > remaining {
+			remaining = left
+		}
+	}
+	return remaining
+}
+
+// CheckMemcachedDecommission marks the pods leaving on a scale down or deletion, they drop out of
+// the proxy pool and get listed in status until they are gone. The workload itself is only shrunk
+// by CheckMemcachedDeploymentScaling once the drain period is over
+func (rc *ReconciliationContext) CheckMemcachedDecommission() ReconcileResult {
+	workload, replicas := rc.memcachedWorkload()
+	if workload == nil {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_decommission] CheckMemcachedDecommission")
+
+	desired := rc.desiredMemcachedReplicas()
+	current := *replicas
+	step := rc.stepReplicas(current)
+
+	if err := rc.updateScalingStatus(current, step, false); err != nil {
+		return Error(err)
+	}
+
+	// Pods are only marked once the step may start, a size that goes back up within the
+	// stabilization window leaves them alone
+	var departing []*corev1.Pod
+	if current > step && rc.stepWait() == 0 {
+		departing = rc.departingPods(step)
+	}
+
+	isDeparting := make(map[string]bool, len(departing))
+	for _, pod := range departing {
+		isDeparting[pod.Name] = true
+		if isPodDecommissioned(pod) {
+			continue
+		}
+
+		patch := client.MergeFrom(pod.DeepCopy())
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[cachev1.DecommissionAnnotation] = time.Now().UTC().Format(time.RFC3339)
+		if rc.Memcached.Spec.Topology != cachev1.TopologyStatefulSet {
+			pod.Annotations[podDeletionCostAnnotation] = "-1000"
+		}
+		if err := rc.Client.Patch(rc.Ctx, pod, patch); err != nil {
+			return Error(err)
+		}
+
+		rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.Decommissioning,
+			"Draining pod %s for %s", pod.Name, rc.Memcached.Spec.DrainPeriod())
+	}
+
+	var decommissioning []string
+	for _, pod := range rc.memcachedPods {
+		if !isPodDecommissioned(pod) {
+			continue
+		}
+		if isDeparting[pod.Name] || pod.GetDeletionTimestamp() != nil {
+			decommissioning = append(decommissioning, pod.Name)
+			continue
+		}
+
+		// The scale down was called off, the pod goes back into service
+		patch := client.MergeFrom(pod.DeepCopy())
+		delete(pod.Annotations, cachev1.DecommissionAnnotation)
+		delete(pod.Annotations, podDeletionCostAnnotation)
+		if err := rc.Client.Patch(rc.Ctx, pod, patch); err != nil {
+			return Error(err)
+		}
+		rc.ReqLogger.Info("Pod is back in service", "Pod", pod.Name)
+	}
+	sort.Strings(decommissioning)
+
+	if !equality.Semantic.DeepEqual(decommissioning, rc.Memcached.Status.DecommissioningPods) {
+		patch := client.MergeFrom(rc.Memcached.DeepCopy())
+		rc.Memcached.Status.DecommissioningPods = decommissioning
+		if err := rc.Client.Status().Patch(rc.Ctx, rc.Memcached, patch); err != nil {
+			rc.ReqLogger.Error(err, "error updating the Memcached decommissioning pods")
+			return Error(err)
+		}
+	}
+
+	if len(decommissioning) != 0 {
+		if err := setCondition(rc, cachev1.MemcachedScalingDown, metav1.ConditionTrue, "Draining",
+			fmt.Sprintf("Draining %d pods, scaling down from %d to %d pods", len(decommissioning), current, desired)); err != nil {
+			return Error(err)
+		}
+	} else if current > desired {
+		if err := setCondition(rc, cachev1.MemcachedScalingDown, metav1.ConditionTrue, "Waiting",
+			fmt.Sprintf("Scaling down from %d to %d pods, waiting for the next step", current, desired)); err != nil {
+			return Error(err)
+		}
+	} else if rc.Memcached.Status.GetConditionStatus(cachev1.MemcachedScalingDown) == metav1.ConditionTrue {
+		if err := setCondition(rc, cachev1.MemcachedScalingDown, metav1.ConditionFalse, "ScaledDown",
+			fmt.Sprintf("Scaled down to %d pods", desired)); err != nil {
+			return Error(err)
+		}
+	}
+
+	return Continue()
+}
@@ -0,0 +1,216 @@
+package reconsilation
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+)
+
+// createdAt is the time createdAgo counts from, so pods created the same time ago tie
+var createdAt = time.Now()
+
+// createdAgo returns a ready memcached pod created d ago
+func createdAgo(name string, d time.Duration) *corev1.Pod {
+	pod := memcachedPod(name, "10.0.0.1", true)
+	pod.CreationTimestamp = metav1.NewTime(createdAt.Add(-d))
+	return pod
+}
+
+// drainingFor returns a memcached pod marked as decommissioned d ago
+func drainingFor(name string, d time.Duration) *corev1.Pod {
+	pod := memcachedPod(name, "10.0.0.1", true)
+	pod.Annotations = map[string]string{
+		cachev1.DecommissionAnnotation: time.Now().Add(-d).UTC().Format(time.RFC3339),
+	}
+	return pod
+}
+
+func podNames(pods []*corev1.Pod) []string {
+	var names []string
+	for _, pod := range pods {
+		names = append(names, pod.Name)
+	}
+	return names
+}
+
+func decommissionStatefulSet(replicas int32) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{Spec: appsv1.StatefulSetSpec{Replicas: &replicas}}
+}
+
+var _ = Describe("Decommission", func() {
+	DescribeTable("Should pick the pods the ReplicaSet removes",
+		func(desired int32, expected []string) {
+			rc := newTestContext(&cachev1.Memcached{})
+			rc.memcachedPods = []*corev1.Pod{
+				createdAgo("cache-a", time.Hour),
+				memcachedPod("cache-b", "10.0.0.2", false),
+				decommissioned(createdAgo("cache-c", time.Hour)),
+				createdAgo("cache-d", 10*time.Minute),
+				createdAgo("cache-e", 5*time.Minute),
+				createdAgo("cache-f", 10*time.Minute),
+				deletingPod(memcachedPod("cache-g", "10.0.0.7", false)),
+			}
+
+			Expect(podNames(rc.departingPods(desired))).To(Equal(expected))
+		},
+		Entry("no surplus", int32(6), nil),
+		Entry("the not ready pods first", int32(5), []string{"cache-b"}),
+		Entry("then the pods already marked", int32(4), []string{"cache-b", "cache-c"}),
+		Entry("then the newest", int32(3), []string{"cache-b", "cache-c", "cache-e"}),
+		Entry("then by name", int32(1), []string{"cache-b", "cache-c", "cache-e", "cache-d", "cache-f"}),
+	)
+
+	It("Should pick the highest ordinals of a StatefulSet", func() {
+		rc := newTestContext(&cachev1.Memcached{Spec: cachev1.MemcachedSpec{Topology: cachev1.TopologyStatefulSet}})
+		rc.memcachedPods = []*corev1.Pod{
+			memcachedPod("cache-0", "10.0.0.1", true),
+			memcachedPod("cache-1", "10.0.0.2", false),
+			memcachedPod("cache-2", "10.0.0.3", true),
+			deletingPod(memcachedPod("cache-3", "10.0.0.4", true)),
+			memcachedPod("cache-4", "10.0.0.5", true),
+			memcachedPod("cache", "10.0.0.6", true),
+		}
+
+		Expect(podNames(rc.departingPods(2))).To(Equal([]string{"cache-2", "cache-4"}))
+	})
+
+	DescribeTable("Should wait for the longest drain",
+		func(marked []time.Duration, expected time.Duration) {
+			rc := newTestContext(&cachev1.Memcached{})
+			var pods []*corev1.Pod
+			for _, d := range marked {
+				pods = append(pods, drainingFor("cache", d))
+			}
+
+			// The mark is stored with a precision of a second
+			Expect(rc.drainRemaining(pods)).To(BeNumerically("~", expected, 2*time.Second))
+		},
+		Entry("no pods", nil, time.Duration(0)),
+		Entry("drain pending", []time.Duration{10 * time.Second}, cachev1.DefaultDrainPeriod-10*time.Second),
+		Entry("the pod marked last", []time.Duration{20 * time.Second, 5 * time.Second},
+			cachev1.DefaultDrainPeriod-5*time.Second),
+		Entry("drained", []time.Duration{time.Minute}, time.Duration(0)),
+	)
+
+	It("Should drain a pod with an unreadable mark for the whole period", func() {
+		rc := newTestContext(&cachev1.Memcached{})
+		pod := memcachedPod("cache-a", "10.0.0.1", true)
+		pod.Annotations = map[string]string{cachev1.DecommissionAnnotation: "soon"}
+
+		Expect(rc.drainRemaining([]*corev1.Pod{pod})).To(BeNumerically("~", cachev1.DefaultDrainPeriod, time.Second))
+	})
+
+	Context("Marking", func() {
+		stored := func(rc *ReconciliationContext, obj client.Object) {
+			Expect(rc.Client.Get(rc.Ctx, client.ObjectKeyFromObject(obj), obj)).To(Succeed())
+		}
+
+		newContext := func(m *cachev1.Memcached, pods ...*corev1.Pod) *ReconciliationContext {
+			objs := make([]client.Object, 0, len(pods))
+			for _, pod := range pods {
+				objs = append(objs, pod)
+			}
+			rc := newTestContext(m, objs...)
+			rc.memcachedPods = pods
+			return rc
+		}
+
+		It("Should mark the departing pods of a Deployment", func() {
+			rc := newContext(
+				&cachev1.Memcached{Spec: cachev1.MemcachedSpec{Size: 1}},
+				createdAgo("cache-a", time.Hour),
+				createdAgo("cache-b", 10*time.Minute),
+				createdAgo("cache-c", 5*time.Minute),
+			)
+			rc.memcachedDeployment = workloadDeployment(3, 3, 3, 3)
+
+			Expect(rc.CheckMemcachedDecommission().Completed()).To(BeFalse())
+
+			for _, name := range []string{"cache-b", "cache-c"} {
+				pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+				stored(rc, pod)
+				Expect(pod.Annotations).To(HaveKey(cachev1.DecommissionAnnotation))
+				Expect(pod.Annotations).To(HaveKeyWithValue(podDeletionCostAnnotation, "-1000"))
+			}
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "cache-a", Namespace: "default"}}
+			stored(rc, pod)
+			Expect(pod.Annotations).To(BeEmpty())
+
+			m := &cachev1.Memcached{ObjectMeta: metav1.ObjectMeta{Name: rc.Memcached.Name, Namespace: "default"}}
+			stored(rc, m)
+			Expect(m.Status.DecommissioningPods).To(Equal([]string{"cache-b", "cache-c"}))
+			Expect(m.Status.GetConditionStatus(cachev1.MemcachedScalingDown)).To(Equal(metav1.ConditionTrue))
+		})
+
+		It("Should mark the highest ordinals of a StatefulSet without a deletion cost", func() {
+			rc := newContext(
+				&cachev1.Memcached{Spec: cachev1.MemcachedSpec{Size: 1, Topology: cachev1.TopologyStatefulSet}},
+				memcachedPod("cache-0", "10.0.0.1", true),
+				memcachedPod("cache-1", "10.0.0.2", true),
+				memcachedPod("cache-2", "10.0.0.3", true),
+			)
+			rc.memcachedStatefulSet = decommissionStatefulSet(3)
+
+			Expect(rc.CheckMemcachedDecommission().Completed()).To(BeFalse())
+
+			for name, marked := range map[string]bool{"cache-0": false, "cache-1": true, "cache-2": true} {
+				pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+				stored(rc, pod)
+				if marked {
+					Expect(pod.Annotations).To(HaveKey(cachev1.DecommissionAnnotation))
+				} else {
+					Expect(pod.Annotations).NotTo(HaveKey(cachev1.DecommissionAnnotation))
+				}
+				Expect(pod.Annotations).NotTo(HaveKey(podDeletionCostAnnotation))
+			}
+		})
+
+		It("Should leave the pods alone within the stabilization window", func() {
+			rc := newContext(
+				&cachev1.Memcached{Spec: cachev1.MemcachedSpec{
+					Size:    1,
+					Scaling: cachev1.Scaling{StabilizationWindow: &metav1.Duration{Duration: time.Minute}},
+				}},
+				createdAgo("cache-a", time.Hour),
+				createdAgo("cache-b", 10*time.Minute),
+			)
+			rc.memcachedDeployment = workloadDeployment(2, 2, 2, 2)
+
+			Expect(rc.CheckMemcachedDecommission().Completed()).To(BeFalse())
+
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "cache-b", Namespace: "default"}}
+			stored(rc, pod)
+			Expect(pod.Annotations).To(BeEmpty())
+			Expect(rc.Memcached.Status.DecommissioningPods).To(BeEmpty())
+		})
+
+		It("Should put the pods back into service when the scale down is called off", func() {
+			marked := decommissioned(createdAgo("cache-b", 10*time.Minute))
+			marked.Annotations[podDeletionCostAnnotation] = "-1000"
+
+			m := &cachev1.Memcached{Spec: cachev1.MemcachedSpec{Size: 2}}
+			m.Status.DecommissioningPods = []string{"cache-b"}
+			rc := newContext(m, createdAgo("cache-a", time.Hour), marked)
+			rc.memcachedDeployment = workloadDeployment(2, 2, 2, 2)
+
+			Expect(rc.CheckMemcachedDecommission().Completed()).To(BeFalse())
+
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "cache-b", Namespace: "default"}}
+			stored(rc, pod)
+			Expect(pod.Annotations).NotTo(HaveKey(cachev1.DecommissionAnnotation))
+			Expect(pod.Annotations).NotTo(HaveKey(podDeletionCostAnnotation))
+
+			stored(rc, m)
+			Expect(m.Status.DecommissioningPods).To(BeEmpty())
+		})
+	})
+})
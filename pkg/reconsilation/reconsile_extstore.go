@@ -0,0 +1,94 @@
+package reconsilation
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+)
+
+const (
+	extstoreVolumeName = "extstore"
+	extstoreMountPath  = "/data"
+	extstoreFileName   = "extstore"
+	// memcachedUID is the user the memcached container runs as, the volume has to be writable for it
+	memcachedUID int64 = 1001
+)
+
+// extstoreOptionsForMemcached builds the ext_* entries of the -o option list
+func extstoreOptionsForMemcached(extstore cachev1.Extstore) []string {
+	if !extstore.Enable {
+		return nil
+	}
+
+	// ext_path takes the file size with a unit suffix, ext_wbuf_size takes megabytes
+	opts := []string{fmt.Sprintf("ext_path=%s/%s:%dM",
+		extstoreMountPath,
+		extstoreFileName,
+		extstore.Size.Value()/1024/1024,
+	)}
+
+	if extstore.WriteBufferSize != nil {
+		opts = append(opts, fmt.Sprintf("ext_wbuf_size=%d", extstore.WriteBufferSize.Value()/1024/1024))
+	}
+	if extstore.ItemSize != nil {
+		opts = append(opts, fmt.Sprintf("ext_item_size=%d", extstore.ItemSize.Value()))
+	}
+	if extstore.Threads != 0 {
+		opts = append(opts, fmt.Sprintf("ext_threads=%d", extstore.Threads))
+	}
+
+	return opts
+}
+
+// extstoreVolumeSourceForMemcached returns an emptyDir limited to the extstore size or a per pod
+// PersistentVolumeClaim, the claim is an ephemeral volume so it follows the pod with both topologies
+func extstoreVolumeSourceForMemcached(extstore cachev1.Extstore) corev1.VolumeSource {
+	if extstore.Volume.Type != cachev1.ExtstoreVolumePersistentVolumeClaim {
+		// One page of headroom over the file, so the kubelet doesn't evict the pod over the
+		// filesystem overhead
+		return corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{
+				SizeLimit: resource.NewQuantity(extstore.Size.Value()+cachev1.ExtstorePageSize, resource.BinarySI),
+			},
+		}
+	}
+
+	return corev1.VolumeSource{
+		Ephemeral: &corev1.EphemeralVolumeSource{
+			VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+					StorageClassName: extstore.Volume.StorageClassName,
+					Resources: corev1.VolumeResourceRequirements{
+						Requests: corev1.ResourceList{
+							corev1.ResourceStorage: *resource.NewQuantity(extstore.Size.Value(), resource.BinarySI),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// addExtstoreVolume mounts the extstore volume into the memcached container of the template
+func (rc *ReconciliationContext) addExtstoreVolume(template *corev1.PodTemplateSpec) {
+	extstore := rc.Memcached.Spec.Extstore
+	if !extstore.Enable {
+		return
+	}
+
+	template.Spec.SecurityContext.FSGroup = &[]int64{memcachedUID}[0]
+	template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+		Name:         extstoreVolumeName,
+		VolumeSource: extstoreVolumeSourceForMemcached(extstore),
+	})
+
+	container := &template.Spec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      extstoreVolumeName,
+		MountPath: extstoreMountPath,
+	})
+}
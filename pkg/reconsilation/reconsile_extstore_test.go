@@ -0,0 +1,33 @@
+package reconsilation
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+)
+
+var _ = Describe("Extstore", func() {
+	It("Should limit the emptyDir to the extstore size plus a page", func() {
+		source := extstoreVolumeSourceForMemcached(cachev1.Extstore{
+			Enable: true,
+			Size:   resource.MustParse("1Gi"),
+		})
+
+		Expect(source.EmptyDir).NotTo(BeNil())
+		Expect(source.EmptyDir.SizeLimit.String()).To(Equal("1088Mi"))
+	})
+
+	It("Should request the extstore size on the PersistentVolumeClaim", func() {
+		source := extstoreVolumeSourceForMemcached(cachev1.Extstore{
+			Enable: true,
+			Size:   resource.MustParse("1Gi"),
+			Volume: cachev1.ExtstoreVolume{Type: cachev1.ExtstoreVolumePersistentVolumeClaim},
+		})
+
+		Expect(source.EmptyDir).To(BeNil())
+		Expect(source.Ephemeral.VolumeClaimTemplate.Spec.Resources.Requests.Storage().String()).To(Equal("1Gi"))
+	})
+})
@@ -3,12 +3,14 @@ package reconsilation
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 
@@ -48,6 +50,16 @@ func labelsForMemcached(name, image string) map[string]string {
 		"app.kubernetes.io/version":    strings.Split(image, ":")[1],
 		"app.kubernetes.io/part-of":    "memcached-operator",
 		"app.kubernetes.io/created-by": "controller-manager",
+		"app.kubernetes.io/managed-by": "memcached-operator",
+	}
+}
+
+// selectorLabelsForMemcached is the subset of labels that stays the same for the
+// whole life of a Memcached, used to find its pods
+func selectorLabelsForMemcached(name string) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/name":     "Memcached",
+		"app.kubernetes.io/instance": name,
 	}
 }
 
@@ -61,18 +73,15 @@ func (rc *ReconciliationContext) serviceForMemcached() (*corev1.Service, error)
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      rc.Memcached.Name,
 			Namespace: rc.Memcached.Namespace,
+			Labels:    ls,
 		},
 		Spec: corev1.ServiceSpec{
-			Ports: []corev1.ServicePort{
-				{
-					Name: "memcached",
-					Port: rc.Memcached.Spec.ContainerPort,
-				},
-			},
-			Selector: ls,
+			Ports:    append(rc.memcachedServicePorts(), rc.metricsServicePort(exporterPort)...),
+			Selector: selectorLabelsForMemcached(rc.Memcached.Name),
 			Type:     corev1.ServiceTypeClusterIP,
 		},
 	}
+	applyServiceSpec(svc, rc.Memcached.Spec.Service)
 
 	if err := ctrl.SetControllerReference(rc.Memcached, svc, rc.Scheme); err != nil {
 		return nil, err
@@ -81,89 +90,115 @@ func (rc *ReconciliationContext) serviceForMemcached() (*corev1.Service, error)
 	return svc, nil
 }
 
-func (rc *ReconciliationContext) deploymentForMemcached() (*appsv1.Deployment, error) {
-	rc.ReqLogger.Info("[reconcile_memcached] deploymentForMemcached")
-
+// podTemplateForMemcached builds the memcached pod template shared by both topologies
+func (rc *ReconciliationContext) podTemplateForMemcached() corev1.PodTemplateSpec {
 	image := imageForMemcached(rc.Memcached.Spec.Image)
 	ls := labelsForMemcached(rc.Memcached.Name, image)
-	replicas := rc.Memcached.Spec.Size
 
-	memLimitKb, isTrue := rc.Memcached.Spec.Resources.Limits.Memory().AsInt64()
-	if !isTrue {
-		memLimitKb = 268435456
-	}
-
-	dep := &appsv1.Deployment{
+	template := corev1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      rc.Memcached.Name,
-			Namespace: rc.Memcached.Namespace,
+			Labels: ls,
 		},
-		Spec: appsv1.DeploymentSpec{
-			Replicas: &replicas,
-			Selector: &metav1.LabelSelector{
-				MatchLabels: ls,
-			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: ls,
-				},
-				Spec: corev1.PodSpec{
-					Affinity: &corev1.Affinity{
-						NodeAffinity: &corev1.NodeAffinity{
-							RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
-								NodeSelectorTerms: []corev1.NodeSelectorTerm{
+		Spec: corev1.PodSpec{
+			Affinity: &corev1.Affinity{
+				NodeAffinity: &corev1.NodeAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+						NodeSelectorTerms: []corev1.NodeSelectorTerm{
+							{
+								MatchExpressions: []corev1.NodeSelectorRequirement{
 									{
-										MatchExpressions: []corev1.NodeSelectorRequirement{
-											{
-												Key:      "kubernetes.io/arch",
-												Operator: "In",
-												Values: []string{
-													"amd64",
-													"arm64",
-													"ppc64le",
-													"s390x",
-												},
-											},
-											{
-												Key:      "kubernetes.io/os",
-												Operator: "In",
-												Values:   []string{"linux"},
-											},
+										Key:      "kubernetes.io/arch",
+										Operator: "In",
+										Values: []string{
+											"amd64",
+											"arm64",
+											"ppc64le",
+											"s390x",
 										},
 									},
+									{
+										Key:      "kubernetes.io/os",
+										Operator: "In",
+										Values:   []string{"linux"},
+									},
 								},
 							},
 						},
 					},
-					SecurityContext: &corev1.PodSecurityContext{
-						RunAsNonRoot: &[]bool{true}[0],
-						SeccompProfile: &corev1.SeccompProfile{
-							Type: corev1.SeccompProfileTypeRuntimeDefault,
+				},
+			},
+			SecurityContext: &corev1.PodSecurityContext{
+				RunAsNonRoot: &[]bool{true}[0],
+				SeccompProfile: &corev1.SeccompProfile{
+					Type: corev1.SeccompProfileTypeRuntimeDefault,
+				},
+			},
+			Containers: []corev1.Container{{
+				Image:           image,
+				Name:            "memcached",
+				ImagePullPolicy: corev1.PullIfNotPresent,
+				SecurityContext: &corev1.SecurityContext{
+					RunAsNonRoot:             &[]bool{true}[0],
+					RunAsUser:                &[]int64{1001}[0],
+					AllowPrivilegeEscalation: &[]bool{false}[0],
+					Capabilities: &corev1.Capabilities{
+						Drop: []corev1.Capability{
+							"ALL",
 						},
 					},
-					Containers: []corev1.Container{{
-						Image:           image,
-						Name:            "memcached",
-						ImagePullPolicy: corev1.PullIfNotPresent,
-						SecurityContext: &corev1.SecurityContext{
-							RunAsNonRoot:             &[]bool{true}[0],
-							RunAsUser:                &[]int64{1001}[0],
-							AllowPrivilegeEscalation: &[]bool{false}[0],
-							Capabilities: &corev1.Capabilities{
-								Drop: []corev1.Capability{
-									"ALL",
-								},
-							},
-						},
-						Ports: []corev1.ContainerPort{{
-							ContainerPort: rc.Memcached.Spec.ContainerPort,
-							Name:          "memcached",
-						}},
-						Command:   rc.buildMemcachedCommand(rc.Memcached.Spec.Verbose, memLimitKb),
-						Resources: rc.Memcached.Spec.Resources,
-					}},
 				},
+				Ports: []corev1.ContainerPort{{
+					ContainerPort: rc.Memcached.Spec.ContainerPort,
+					Name:          "memcached",
+				}},
+				Command: rc.buildMemcachedCommand(
+					rc.Memcached.Spec.Verbose,
+					rc.Memcached.Spec.CacheSize(),
+					rc.Memcached.Spec.Tuning,
+					rc.Memcached.Spec.Extstore,
+					rc.Memcached.Spec.TLS,
+				),
+				Resources: rc.Memcached.Spec.Resources,
+			}},
+		},
+	}
+
+	rc.memcachedProbes().apply(&template.Spec.Containers[0])
+	addDefaultScheduling(&template.Spec, selectorLabelsForMemcached(rc.Memcached.Name))
+	rc.addMemcachedUDP(&template)
+	rc.addExtstoreVolume(&template)
+	rc.addMemcachedAuth(&template)
+	rc.addMemcachedTLS(&template)
+	rc.addMemcachedExporter(&template)
+
+	if hashes := rc.secretHashesForMemcached(); len(hashes) != 0 {
+		template.Annotations = hashes
+	}
+
+	applyPodTemplate(&template, rc.Memcached.Spec.PodTemplate)
+
+	return template
+}
+
+func (rc *ReconciliationContext) deploymentForMemcached() (*appsv1.Deployment, error) {
+	rc.ReqLogger.Info("[reconcile_memcached] deploymentForMemcached")
+
+	image := imageForMemcached(rc.Memcached.Spec.Image)
+	ls := labelsForMemcached(rc.Memcached.Name, image)
+	replicas := rc.Memcached.Spec.Size
+
+	dep := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      rc.Memcached.Name,
+			Namespace: rc.Memcached.Namespace,
+			Labels:    ls,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: selectorLabelsForMemcached(rc.Memcached.Name),
 			},
+			Template: rc.podTemplateForMemcached(),
 		},
 	}
 
@@ -171,38 +206,77 @@ func (rc *ReconciliationContext) deploymentForMemcached() (*appsv1.Deployment, e
 		return nil, err
 	}
 
-	selector, _ := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{
-		MatchLabels: ls,
-	})
+	return dep, nil
+}
 
-	rc.Memcached.Status.Selector = selector.String()
+// memcachedWorkload returns the Deployment or StatefulSet running the Memcached pods together with
+// a pointer to its replicas, the object is nil until one of them has been loaded
+func (rc *ReconciliationContext) memcachedWorkload() (client.Object, *int32) {
+	if rc.memcachedStatefulSet != nil {
+		return rc.memcachedStatefulSet, rc.memcachedStatefulSet.Spec.Replicas
+	}
+	if rc.memcachedDeployment != nil {
+		return rc.memcachedDeployment, rc.memcachedDeployment.Spec.Replicas
+	}
+	return nil, nil
+}
 
-	return dep, nil
+// memcachedPodTemplate returns the pod template of the loaded Memcached workload, nil until one
+// of them has been loaded
+func (rc *ReconciliationContext) memcachedPodTemplate() *corev1.PodTemplateSpec {
+	if rc.memcachedStatefulSet != nil {
+		return &rc.memcachedStatefulSet.Spec.Template
+	}
+	if rc.memcachedDeployment != nil {
+		return &rc.memcachedDeployment.Spec.Template
+	}
+	return nil
 }
 
+// CheckMemcachedDeploymentScaling keeps the replicas of the Memcached workload in line with
+// Spec.Size, for both the Deployment and the StatefulSet topology. A scale down waits until the
+// pods marked by CheckMemcachedDecommission have drained, the later steps still run meanwhile and
+// the reconcile comes back once the wait is over
 func (rc *ReconciliationContext) CheckMemcachedDeploymentScaling() ReconcileResult {
 	logger := rc.ReqLogger
 	m := rc.Memcached
-	dep := rc.memcachedDeployment
+	workload, replicas := rc.memcachedWorkload()
 
-	if dep == nil {
+	if workload == nil {
 		return Continue()
 	}
 
 	logger.Info("[reconcile_memcached] CheckMemcachedDeploymentScaling")
 
-	desiredReplicas := rc.Memcached.Spec.Size
-	currentReplicas := *dep.Spec.Replicas
-
-	if currentReplicas != desiredReplicas {
-		mPatch := client.MergeFrom(m.DeepCopy())
-
-		err := rc.Client.Status().Patch(rc.Ctx, m, mPatch)
-		if err != nil {
-			logger.Error(err, "error patching memcached for scaling")
-			return Error(err)
+	desiredReplicas := rc.desiredMemcachedReplicas()
+	currentReplicas := *replicas
+
+	targetReplicas := desiredReplicas
+	if currentReplicas > desiredReplicas {
+		// Scale downs go in steps of spec.scaling.maxStepDown
+		desiredReplicas = rc.stepReplicas(currentReplicas)
+
+		if wait := rc.stepWait(); wait > 0 {
+			rc.ReqLogger.Info(
+				"Waiting for the next scale down step",
+				"Memcached", m.Name,
+				"remaining", wait.String(),
+			)
+			rc.requeueWithin(wait)
+			return Continue()
+		}
+		if remaining := rc.drainRemaining(rc.departingPods(desiredReplicas)); remaining > 0 {
+			rc.ReqLogger.Info(
+				"Waiting for the departing pods to drain",
+				"Memcached", m.Name,
+				"remaining", remaining.String(),
+			)
+			rc.requeueWithin(remaining)
+			return Continue()
 		}
+	}
 
+	if currentReplicas != desiredReplicas {
 		rc.ReqLogger.Info(
 			"Need to update the memcached's replicas",
 			"Memcached", m.Name,
@@ -212,7 +286,7 @@ func (rc *ReconciliationContext) CheckMemcachedDeploymentScaling() ReconcileResu
 
 		if currentReplicas > desiredReplicas {
 			rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.ScalingDown,
-				"Scaling down %s", m.Name)
+				"Scaling down %s from %d to %d pods, target %d", m.Name, currentReplicas, desiredReplicas, targetReplicas)
 		} else if currentReplicas < desiredReplicas {
 			rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.ScalingUp,
 				"Scaling up %s", m.Name)
@@ -222,17 +296,31 @@ func (rc *ReconciliationContext) CheckMemcachedDeploymentScaling() ReconcileResu
 			return Error(err)
 		}
 
-		patch := client.MergeFrom(dep.DeepCopy())
-		dep.Spec.Replicas = &desiredReplicas
-		if err := rc.Client.Patch(rc.Ctx, dep, patch); err != nil {
+		patch := client.MergeFrom(workload.DeepCopyObject().(client.Object))
+		*replicas = desiredReplicas
+		if err := rc.Client.Patch(rc.Ctx, workload, patch); err != nil {
+			logger.Error(err, "error patching memcached for scaling")
 			return Error(err)
 		}
+
+		if currentReplicas > desiredReplicas {
+			if err := rc.updateScalingStatus(desiredReplicas, desiredReplicas, true); err != nil {
+				return Error(err)
+			}
+			if desiredReplicas > targetReplicas {
+				rc.requeueWithin(rc.Memcached.Spec.StepInterval())
+			}
+		}
 	}
 
 	return Continue()
 }
 
 func (rc *ReconciliationContext) CheckMemcachedDeploymentCreation() ReconcileResult {
+	if rc.Memcached.Spec.Topology == cachev1.TopologyStatefulSet {
+		return Continue()
+	}
+
 	rc.ReqLogger.Info("[reconcile_memcached] CheckMemcachedDeploymentCreation")
 
 	// Check if the desired Deployment already exists
@@ -281,15 +369,30 @@ func (rc *ReconciliationContext) CheckMemcachedDeploymentCreation() ReconcileRes
 
 func (rc *ReconciliationContext) buildMemcachedCommand(
 	verboseLevel cachev1.VerboseLevel,
-	memLimitKb int64,
+	cacheSize int64,
+	tuning cachev1.Tuning,
+	extstore cachev1.Extstore,
+	tls cachev1.TLS,
 ) []string {
 	rc.ReqLogger.Info("[reconcile_memcached] buildMemcachedCommand")
 
-	cmd := []string{"memcached", "-o", "modern"}
+	opts := extendedOptionsForMemcached(tuning)
+	opts = append(opts, extstoreOptionsForMemcached(extstore)...)
+	opts = append(opts, tlsOptionsForMemcached(tls)...)
+	cmd := []string{"memcached", "-o", strings.Join(opts, ",")}
+	if tls.Enable {
+		cmd = append(cmd, "-Z")
+	}
 
-	memLimit := (memLimitKb / 1024 / 1024) - 128
+	// --memory-limit takes megabytes
+	memLimit := cacheSize / 1024 / 1024
+	if memLimit < 1 {
+		memLimit = 1
+	}
 	cmd = append(cmd, fmt.Sprintf("--memory-limit=%v", memLimit))
 
+	cmd = append(cmd, tuningFlagsForMemcached(tuning)...)
+
 	switch verboseLevel {
 	case cachev1.Enabled:
 		cmd = append(cmd, "-v")
@@ -305,7 +408,7 @@ func (rc *ReconciliationContext) buildMemcachedCommand(
 }
 
 func (rc *ReconciliationContext) CheckMemcachedServiceCreation() ReconcileResult {
-	if rc.memcachedDeployment == nil {
+	if workload, _ := rc.memcachedWorkload(); workload == nil {
 		return Continue()
 	}
 
@@ -335,6 +438,8 @@ func (rc *ReconciliationContext) CheckMemcachedServiceCreation() ReconcileResult
 			return Error(err)
 		}
 
+		rc.memcachedService = svc
+
 		rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.CreatedResource,
 			"Created Service %s", svc.Name)
 		return Continue()
@@ -346,5 +451,170 @@ func (rc *ReconciliationContext) CheckMemcachedServiceCreation() ReconcileResult
 		return Error(err)
 	}
 
+	rc.memcachedService = currentService
+
+	return Continue()
+}
+
+// CheckMemcachedDeploymentDrift brings the Deployment back in line with the Memcached spec,
+// replicas are left to CheckMemcachedDeploymentScaling
+func (rc *ReconciliationContext) CheckMemcachedDeploymentDrift() ReconcileResult {
+	if rc.memcachedDeployment == nil {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_memcached] CheckMemcachedDeploymentDrift")
+
+	desiredDeployment, err := rc.deploymentForMemcached()
+	if err != nil {
+		return Error(err)
+	}
+
+	return rc.updateDeploymentIfDrifted(rc.memcachedDeployment, desiredDeployment)
+}
+
+// CheckMemcachedServiceDrift brings the Service back in line with the Memcached spec
+func (rc *ReconciliationContext) CheckMemcachedServiceDrift() ReconcileResult {
+	if rc.memcachedService == nil {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_memcached] CheckMemcachedServiceDrift")
+
+	desiredService, err := rc.serviceForMemcached()
+	if err != nil {
+		return Error(err)
+	}
+
+	return rc.updateServiceIfDrifted(rc.memcachedService, desiredService)
+}
+
+// extendedOptionsForMemcached builds the -o option list, "modern" stays first so the
+// command of an untuned Memcached doesn't change
+func extendedOptionsForMemcached(tuning cachev1.Tuning) []string {
+	opts := []string{"modern"}
+
+	if tuning.LRUCrawler != nil {
+		if *tuning.LRUCrawler {
+			opts = append(opts, "lru_crawler")
+		} else {
+			opts = append(opts, "no_lru_crawler")
+		}
+	}
+	if tuning.LRUMaintainer != nil {
+		if *tuning.LRUMaintainer {
+			opts = append(opts, "lru_maintainer")
+		} else {
+			opts = append(opts, "no_lru_maintainer")
+		}
+	}
+	if tuning.HotLRUPercent != 0 {
+		opts = append(opts, fmt.Sprintf("hot_lru_pct=%d", tuning.HotLRUPercent))
+	}
+	if tuning.WarmLRUPercent != 0 {
+		opts = append(opts, fmt.Sprintf("warm_lru_pct=%d", tuning.WarmLRUPercent))
+	}
+
+	return opts
+}
+
+func tuningFlagsForMemcached(tuning cachev1.Tuning) []string {
+	var flags []string
+
+	if tuning.Threads != 0 {
+		flags = append(flags, fmt.Sprintf("--threads=%d", tuning.Threads))
+	}
+	if tuning.MaxConnections != 0 {
+		flags = append(flags, fmt.Sprintf("--conn-limit=%d", tuning.MaxConnections))
+	}
+	if tuning.MaxItemSize != nil {
+		flags = append(flags, fmt.Sprintf("--max-item-size=%d", tuning.MaxItemSize.Value()))
+	}
+	if tuning.GrowthFactor != "" {
+		flags = append(flags, fmt.Sprintf("--slab-growth-factor=%s", tuning.GrowthFactor))
+	}
+	if tuning.MinSpace != 0 {
+		flags = append(flags, fmt.Sprintf("--slab-min-size=%d", tuning.MinSpace))
+	}
+	if tuning.MaxRequestsPerEvent != 0 {
+		flags = append(flags, fmt.Sprintf("--max-reqs-per-event=%d", tuning.MaxRequestsPerEvent))
+	}
+	if tuning.Protocol != "" {
+		flags = append(flags, fmt.Sprintf("--protocol=%s", tuning.Protocol))
+	}
+
+	return flags
+}
+
+// CheckMemcachedMemoryStatus reports the cache size computed from the memory policy
+func (rc *ReconciliationContext) CheckMemcachedMemoryStatus() ReconcileResult {
+	rc.ReqLogger.Info("[reconcile_memcached] CheckMemcachedMemoryStatus")
+
+	memoryLimit := resource.NewQuantity(rc.Memcached.Spec.CacheSize(), resource.BinarySI)
+	if rc.Memcached.Status.MemoryLimit != nil && rc.Memcached.Status.MemoryLimit.Cmp(*memoryLimit) == 0 {
+		return Continue()
+	}
+
+	patch := client.MergeFrom(rc.Memcached.DeepCopy())
+	rc.Memcached.Status.MemoryLimit = memoryLimit
+	if err := rc.Client.Status().Patch(rc.Ctx, rc.Memcached, patch); err != nil {
+		rc.ReqLogger.Error(err, "error updating the Memcached memory limit")
+		return Error(err)
+	}
+
+	return Continue()
+}
+
+// secretHashesForMemcached returns the hash annotations of the Secrets memcached only reads on startup
+func (rc *ReconciliationContext) secretHashesForMemcached() map[string]string {
+	hashes := map[string]string{}
+	if rc.memcachedAuthSecret != nil {
+		hashes[cachev1.AuthSecretHashAnnotation] = hashAuthSecret(rc.memcachedAuthSecret, authSecretKey(rc.Memcached.Spec.Auth))
+	}
+	if rc.memcachedTLSSecret != nil && rc.tlsReloadNeedsRestart() {
+		hashes[cachev1.TLSSecretHashAnnotation] = hashSecretData(rc.memcachedTLSSecret)
+	}
+	return hashes
+}
+
+// CheckMemcachedSecretRollout restarts the memcached pods when a Secret they only read on startup
+// changes, a missing hash means the feature is being turned on and is left to the drift check
+func (rc *ReconciliationContext) CheckMemcachedSecretRollout() ReconcileResult {
+	workload, _ := rc.memcachedWorkload()
+	if workload == nil {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_memcached] CheckMemcachedSecretRollout")
+
+	template := rc.memcachedPodTemplate()
+	changed := map[string]string{}
+	for annotation, desiredHash := range rc.secretHashesForMemcached() {
+		if current, found := template.Annotations[annotation]; found && current != desiredHash {
+			changed[annotation] = desiredHash
+		}
+	}
+	if len(changed) == 0 {
+		return Continue()
+	}
+
+	if err := setOperatorProgressStatus(rc, cachev1.ProgressUpdating); err != nil {
+		return Error(err)
+	}
+
+	patch := client.MergeFrom(workload.DeepCopyObject().(client.Object))
+	annotations := make([]string, 0, len(changed))
+	for annotation, desiredHash := range changed {
+		template.Annotations[annotation] = desiredHash
+		annotations = append(annotations, annotation)
+	}
+	if err := rc.Client.Patch(rc.Ctx, workload, patch); err != nil {
+		return Error(err)
+	}
+
+	sort.Strings(annotations)
+	rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.RollingRestart,
+		"Restarting %s, Secrets changed: %s", workload.GetName(), strings.Join(annotations, ", "))
+
 	return Continue()
 }
@@ -0,0 +1,307 @@
+package reconsilation
+
+import (
+	"fmt"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+)
+
+const (
+	metricsPortName             = "metrics"
+	exporterContainerName       = "exporter"
+	exporterPort          int32 = 9150
+	proxyExporterPort     int32 = 9151
+	// proxyStatsPort is the twemproxy default stats port
+	proxyStatsPort int32 = 22222
+)
+
+var (
+	serviceMonitorGVK = schema.GroupVersionKind{
+		Group:   "monitoring.coreos.com",
+		Version: "v1",
+		Kind:    "ServiceMonitor",
+	}
+	prometheusRuleGVK = schema.GroupVersionKind{
+		Group:   "monitoring.coreos.com",
+		Version: "v1",
+		Kind:    "PrometheusRule",
+	}
+)
+
+// imageForExporter resolves an exporter image the same way as the memcached and proxy images,
+// spec first, then the operator environment, then the default
+func imageForExporter(exporterImage cachev1.DockerImage, imageEnvVar, defaultImage string) string {
+	if exporterImage.Name != "" || exporterImage.Tag != "" {
+		if exporterImage.Tag == "" {
+			return fmt.Sprintf("%s:latest", exporterImage.Name)
+		}
+		return fmt.Sprintf("%s:%s", exporterImage.Name, exporterImage.Tag)
+	}
+	if image, found := os.LookupEnv(imageEnvVar); found {
+		return image
+	}
+	return defaultImage
+}
+
+func exporterContainer(image string, port int32, resources corev1.ResourceRequirements, args []string) corev1.Container {
+	return corev1.Container{
+		Image:           image,
+		Name:            exporterContainerName,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		SecurityContext: &corev1.SecurityContext{
+			RunAsNonRoot:             &[]bool{true}[0],
+			AllowPrivilegeEscalation: &[]bool{false}[0],
+			Capabilities: &corev1.Capabilities{
+				Drop: []corev1.Capability{
+					"ALL",
+				},
+			},
+		},
+		Ports: []corev1.ContainerPort{{
+			ContainerPort: port,
+			Name:          metricsPortName,
+		}},
+		Args:      args,
+		Resources: resources,
+	}
+}
+
+// addMemcachedExporter adds the memcached_exporter sidecar to the memcached pod template
+func (rc *ReconciliationContext) addMemcachedExporter(template *corev1.PodTemplateSpec) {
+	monitoring := rc.Memcached.Spec.Monitoring
+	if !monitoring.Enable {
+		return
+	}
+
+	args := []string{
+		fmt.Sprintf("--memcached.address=localhost:%d", rc.Memcached.Spec.ContainerPort),
+		fmt.Sprintf("--web.listen-address=:%d", exporterPort),
+	}
+
+	var mounts []corev1.VolumeMount
+	if rc.Memcached.Spec.TLS.Enable {
+		// the certificate doesn't name localhost, the exporter only reads stats from its own pod
+		args = append(args,
+			"--memcached.tls.enable",
+			fmt.Sprintf("--memcached.tls.cert-file=%s/%s", tlsMountPath, corev1.TLSCertKey),
+			fmt.Sprintf("--memcached.tls.key-file=%s/%s", tlsMountPath, corev1.TLSPrivateKeyKey),
+			"--memcached.tls.insecure-skip-verify",
+		)
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      tlsVolumeName,
+			MountPath: tlsMountPath,
+			ReadOnly:  true,
+		})
+	}
+
+	container := exporterContainer(
+		imageForExporter(monitoring.ExporterImage, "EXPORTER_IMAGE", cachev1.ExporterDefaultImage),
+		exporterPort,
+		monitoring.Resources,
+		args,
+	)
+	container.VolumeMounts = mounts
+
+	template.Spec.Containers = append(template.Spec.Containers, container)
+}
+
+// addProxyExporter adds the twemproxy stats exporter sidecar to the proxy pod template
+func (rc *ReconciliationContext) addProxyExporter(template *corev1.PodTemplateSpec) {
+	monitoring := rc.Memcached.Spec.Monitoring
+	if !monitoring.Enable {
+		return
+	}
+
+	template.Spec.Containers = append(template.Spec.Containers, exporterContainer(
+		imageForExporter(monitoring.ProxyExporterImage, "PROXY_EXPORTER_IMAGE", cachev1.ProxyExporterDefaultImage),
+		proxyExporterPort,
+		monitoring.Resources,
+		[]string{
+			fmt.Sprintf("--twemproxy.address=localhost:%d", proxyStatsPort),
+			fmt.Sprintf("--web.listen-address=:%d", proxyExporterPort),
+		},
+	))
+}
+
+// metricsServicePort returns the metrics port of a Service, nil when monitoring is off
+func (rc *ReconciliationContext) metricsServicePort(port int32) []corev1.ServicePort {
+	if !rc.Memcached.Spec.Monitoring.Enable {
+		return nil
+	}
+	return []corev1.ServicePort{{
+		Name: metricsPortName,
+		Port: port,
+	}}
+}
+
+func (rc *ReconciliationContext) labelsForMonitoring() map[string]string {
+	image := imageForMemcached(rc.Memcached.Spec.Image)
+	return mergeStringMaps(rc.Memcached.Spec.Monitoring.Labels, labelsForMemcached(rc.Memcached.Name, image))
+}
+
+func (rc *ReconciliationContext) serviceMonitorForMemcached() (*unstructured.Unstructured, error) {
+	rc.ReqLogger.Info("[reconcile_monitoring] serviceMonitorForMemcached")
+
+	m := rc.Memcached
+
+	endpoint := map[string]interface{}{
+		"port": metricsPortName,
+	}
+	if m.Spec.Monitoring.Interval != "" {
+		endpoint["interval"] = m.Spec.Monitoring.Interval
+	}
+
+	// Both tiers are selected, only the Services with a metrics port get scraped
+	spec := map[string]interface{}{
+		"selector": map[string]interface{}{
+			"matchLabels": map[string]interface{}{
+				"app.kubernetes.io/managed-by": "memcached-operator",
+			},
+			"matchExpressions": []interface{}{
+				map[string]interface{}{
+					"key":      "app.kubernetes.io/instance",
+					"operator": "In",
+					"values":   []interface{}{m.Name, fmt.Sprintf("%s-proxy", m.Name)},
+				},
+			},
+		},
+		"endpoints": []interface{}{endpoint},
+	}
+
+	return rc.unstructuredForMonitoring(serviceMonitorGVK, spec)
+}
+
+func (rc *ReconciliationContext) prometheusRuleForMemcached() (*unstructured.Unstructured, error) {
+	rc.ReqLogger.Info("[reconcile_monitoring] prometheusRuleForMemcached")
+
+	m := rc.Memcached
+	selector := fmt.Sprintf(`namespace="%s",service="%s"`, m.Namespace, m.Name)
+
+	alert := func(name, expr, duration, severity, summary string) interface{} {
+		return map[string]interface{}{
+			"alert": name,
+			"expr":  expr,
+			"for":   duration,
+			"labels": map[string]interface{}{
+				"severity": severity,
+			},
+			"annotations": map[string]interface{}{
+				"summary": summary,
+			},
+		}
+	}
+
+	spec := map[string]interface{}{
+		"groups": []interface{}{
+			map[string]interface{}{
+				"name": fmt.Sprintf("%s.memcached", m.Name),
+				"rules": []interface{}{
+					alert("MemcachedDown",
+						fmt.Sprintf(`memcached_up{%s} == 0`, selector),
+						"5m", "critical",
+						fmt.Sprintf("Memcached %s/%s pod {{ $labels.pod }} is down", m.Namespace, m.Name)),
+					alert("MemcachedHighEvictionRate",
+						fmt.Sprintf(`sum by (pod) (rate(memcached_items_evicted_total{%s}[5m])) > 10`, selector),
+						"15m", "warning",
+						fmt.Sprintf("Memcached %s/%s pod {{ $labels.pod }} evicts more than 10 items/s", m.Namespace, m.Name)),
+					alert("MemcachedLowHitRatio",
+						fmt.Sprintf(`sum(rate(memcached_commands_total{%[1]s,command="get",status="hit"}[5m])) / sum(rate(memcached_commands_total{%[1]s,command="get"}[5m])) < 0.8`, selector),
+						"15m", "warning",
+						fmt.Sprintf("Memcached %s/%s hit ratio is below 80%%", m.Namespace, m.Name)),
+					alert("MemcachedConnectionsNearLimit",
+						fmt.Sprintf(`max by (pod) (memcached_current_connections{%[1]s} / memcached_max_connections{%[1]s}) > 0.9`, selector),
+						"5m", "warning",
+						fmt.Sprintf("Memcached %s/%s pod {{ $labels.pod }} uses more than 90%% of its connections", m.Namespace, m.Name)),
+				},
+			},
+		},
+	}
+
+	return rc.unstructuredForMonitoring(prometheusRuleGVK, spec)
+}
+
+func (rc *ReconciliationContext) unstructuredForMonitoring(gvk schema.GroupVersionKind, spec map[string]interface{}) (*unstructured.Unstructured, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	obj.SetName(rc.Memcached.Name)
+	obj.SetNamespace(rc.Memcached.Namespace)
+	obj.SetLabels(rc.labelsForMonitoring())
+	if err := unstructured.SetNestedMap(obj.Object, spec, "spec"); err != nil {
+		return nil, err
+	}
+
+	if err := ctrl.SetControllerReference(rc.Memcached, obj, rc.Scheme); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// CheckMemcachedMonitoring keeps the ServiceMonitor and PrometheusRule in line with spec.monitoring,
+// each one is skipped when the prometheus-operator doesn't serve its kind. The kinds are only looked
+// up while monitoring is enabled or an object is left to clean up
+func (rc *ReconciliationContext) CheckMemcachedMonitoring() ReconcileResult {
+	enabled := rc.Memcached.Spec.Monitoring.Enable
+	if !enabled && !rc.optionalResourceCreated(serviceMonitorGVK.Kind) &&
+		!rc.optionalResourceCreated(prometheusRuleGVK.Kind) {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_monitoring] CheckMemcachedMonitoring")
+
+	objects := []struct {
+		gvk     schema.GroupVersionKind
+		desired func() (*unstructured.Unstructured, error)
+	}{
+		{serviceMonitorGVK, rc.serviceMonitorForMemcached},
+		{prometheusRuleGVK, rc.prometheusRuleForMemcached},
+	}
+
+	for _, o := range objects {
+		if !enabled && !rc.optionalResourceCreated(o.gvk.Kind) {
+			continue
+		}
+
+		exists, err := rc.kindExists(o.gvk)
+		if err != nil {
+			return Error(err)
+		}
+		if !exists && enabled {
+			rc.ReqLogger.Info("Skipping "+o.gvk.Kind+", the CRD is not installed", "Memcached", rc.Memcached.Name)
+			continue
+		}
+
+		if !enabled {
+			if exists {
+				if err := rc.deleteOwnedUnstructured(o.gvk, rc.Memcached.Name); err != nil {
+					return Error(err)
+				}
+			}
+			if err := setOptionalResource(rc, o.gvk.Kind, false); err != nil {
+				return Error(err)
+			}
+			continue
+		}
+
+		desired, err := o.desired()
+		if err != nil {
+			return Error(err)
+		}
+		if err := rc.applyUnstructured(desired); err != nil {
+			return Error(err)
+		}
+		if err := setOptionalResource(rc, o.gvk.Kind, true); err != nil {
+			return Error(err)
+		}
+	}
+
+	return Continue()
+}
@@ -0,0 +1,43 @@
+package reconsilation
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+)
+
+var _ = Describe("Monitoring", func() {
+	It("Should not look the prometheus-operator kinds up while monitoring is off", func() {
+		rc := newTestContext(&cachev1.Memcached{})
+		mapper := countRESTMappings(rc)
+
+		Expect(rc.CheckMemcachedMonitoring().Completed()).To(BeFalse())
+		Expect(mapper.lookups).To(BeZero())
+	})
+
+	It("Should only look up the kinds left to clean up", func() {
+		rc := newTestContext(&cachev1.Memcached{Status: cachev1.MemcachedStatus{
+			OptionalResources: []string{"Certificate", "ServiceMonitor"},
+		}})
+		mapper := countRESTMappings(rc)
+
+		Expect(rc.CheckMemcachedMonitoring().Completed()).To(BeFalse())
+		Expect(mapper.lookups).To(Equal(1))
+		Expect(rc.Memcached.Status.OptionalResources).To(Equal([]string{"Certificate"}))
+
+		Expect(rc.CheckMemcachedMonitoring().Completed()).To(BeFalse())
+		Expect(mapper.lookups).To(Equal(1))
+	})
+
+	It("Should skip the kinds that aren't installed while monitoring is on", func() {
+		rc := newTestContext(&cachev1.Memcached{Spec: cachev1.MemcachedSpec{
+			Monitoring: cachev1.Monitoring{Enable: true},
+		}})
+		mapper := countRESTMappings(rc)
+
+		Expect(rc.CheckMemcachedMonitoring().Completed()).To(BeFalse())
+		Expect(mapper.lookups).To(Equal(2))
+		Expect(rc.Memcached.Status.OptionalResources).To(BeEmpty())
+	})
+})
@@ -0,0 +1,177 @@
+package reconsilation
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+	"github.com/0x0BSoD/memcached-operator/pkg/events"
+)
+
+// minAvailableForPods turns maxUnavailable into the minAvailable of the PDB, so the budget follows
+// the replicas: a minAvailable above the new replicas would block every eviction after a scale down.
+// At least one pod may always go, otherwise node drains hang
+func minAvailableForPods(replicas int32, maxUnavailable *intstr.IntOrString) int32 {
+	unavailable := 1
+	if maxUnavailable != nil {
+		scaled, err := intstr.GetScaledValueFromIntOrPercent(maxUnavailable, int(replicas), false)
+		if err == nil && scaled > 1 {
+			unavailable = scaled
+		}
+	}
+
+	minAvailable := replicas - int32(unavailable)
+	if minAvailable < 0 {
+		return 0
+	}
+	return minAvailable
+}
+
+func (rc *ReconciliationContext) pdbForPods(
+	name string,
+	labels, selector map[string]string,
+	replicas int32,
+	maxUnavailable *intstr.IntOrString,
+) (*policyv1.PodDisruptionBudget, error) {
+	minAvailable := intstr.FromInt32(minAvailableForPods(replicas, maxUnavailable))
+
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: rc.Memcached.Namespace,
+			Labels:    labels,
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MinAvailable: &minAvailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: selector,
+			},
+		},
+	}
+
+	if err := ctrl.SetControllerReference(rc.Memcached, pdb, rc.Scheme); err != nil {
+		return nil, err
+	}
+
+	return pdb, nil
+}
+
+func (rc *ReconciliationContext) pdbForMemcached() (*policyv1.PodDisruptionBudget, error) {
+	rc.ReqLogger.Info("[reconcile_pdb] pdbForMemcached")
+
+	image := imageForMemcached(rc.Memcached.Spec.Image)
+
+	return rc.pdbForPods(
+		rc.Memcached.Name,
+		labelsForMemcached(rc.Memcached.Name, image),
+		selectorLabelsForMemcached(rc.Memcached.Name),
+		rc.desiredMemcachedReplicas(),
+		rc.Memcached.Spec.MaxUnavailable,
+	)
+}
+
+func (rc *ReconciliationContext) pdbForProxy() (*policyv1.PodDisruptionBudget, error) {
+	rc.ReqLogger.Info("[reconcile_pdb] pdbForProxy")
+
+	image := imageForProxy(rc.Memcached.Spec.Proxy.Image)
+
+	return rc.pdbForPods(
+		fmt.Sprintf("%s-proxy", rc.Memcached.Name),
+		labelsForProxy(rc.Memcached.Name, image),
+		selectorLabelsForProxy(rc.Memcached.Name),
+		rc.Memcached.Spec.Proxy.Replicas,
+		rc.Memcached.Spec.Proxy.MaxUnavailable,
+	)
+}
+
+// applyPodDisruptionBudget creates the PDB or brings its labels and spec back in line with desired
+func (rc *ReconciliationContext) applyPodDisruptionBudget(desired *policyv1.PodDisruptionBudget) ReconcileResult {
+	current := &policyv1.PodDisruptionBudget{}
+	err := rc.Client.Get(rc.Ctx,
+		types.NamespacedName{
+			Name:      desired.Name,
+			Namespace: desired.Namespace,
+		}, current)
+	if errors.IsNotFound(err) {
+		if err := setOperatorProgressStatus(rc, cachev1.ProgressUpdating); err != nil {
+			return Error(err)
+		}
+
+		if err := rc.Client.Create(rc.Ctx, desired); err != nil {
+			return Error(err)
+		}
+
+		rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.CreatedResource,
+			"Created PodDisruptionBudget %s", desired.Name)
+		return Continue()
+	} else if err != nil {
+		rc.ReqLogger.Error(
+			err,
+			"Could not locate PodDisruptionBudget for",
+			"Memcached", rc.Memcached.Name)
+		return Error(err)
+	}
+
+	if equality.Semantic.DeepDerivative(desired.Spec, current.Spec) &&
+		equality.Semantic.DeepDerivative(desired.Labels, current.Labels) {
+		return Continue()
+	}
+
+	patch := client.MergeFrom(current.DeepCopy())
+	current.Labels = mergeStringMaps(current.Labels, desired.Labels)
+	current.Spec.MinAvailable = desired.Spec.MinAvailable
+	current.Spec.MaxUnavailable = nil
+	current.Spec.Selector = desired.Spec.Selector
+	if err := rc.Client.Patch(rc.Ctx, current, patch); err != nil {
+		return Error(err)
+	}
+
+	rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.UpdatedResource,
+		"Updated PodDisruptionBudget %s, minAvailable %s", current.Name, desired.Spec.MinAvailable.String())
+
+	return Continue()
+}
+
+// CheckMemcachedPodDisruptionBudget keeps the memcached PDB in line with Size and MaxUnavailable
+func (rc *ReconciliationContext) CheckMemcachedPodDisruptionBudget() ReconcileResult {
+	if workload, _ := rc.memcachedWorkload(); workload == nil {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_pdb] CheckMemcachedPodDisruptionBudget")
+
+	desired, err := rc.pdbForMemcached()
+	if err != nil {
+		return Error(err)
+	}
+
+	return rc.applyPodDisruptionBudget(desired)
+}
+
+// CheckProxyPodDisruptionBudget keeps the proxy PDB in line with Replicas and MaxUnavailable,
+// CheckProxyTeardown removes it with the proxy
+func (rc *ReconciliationContext) CheckProxyPodDisruptionBudget() ReconcileResult {
+	if rc.proxyDeployment == nil || !rc.Memcached.Spec.Proxy.Enable {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_pdb] CheckProxyPodDisruptionBudget")
+
+	desired, err := rc.pdbForProxy()
+	if err != nil {
+		return Error(err)
+	}
+
+	return rc.applyPodDisruptionBudget(desired)
+}
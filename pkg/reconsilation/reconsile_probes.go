@@ -0,0 +1,152 @@
+package reconsilation
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+)
+
+// probeSet holds the liveness, readiness and startup probes of a container
+type probeSet struct {
+	liveness  *corev1.Probe
+	readiness *corev1.Probe
+	startup   *corev1.Probe
+}
+
+// memcachedProbeHandler does a version round trip over the text protocol. With the ASCII auth file
+// an unauthenticated client gets CLIENT_ERROR back, which still proves the event loop answers.
+// TLS, SASL and the binary protocol can't be spoken from a shell, those fall back to a TCP check.
+// The round trip needs sh and nc, only the default image is known to ship them, any other image
+// gets the TCP check as well
+func (rc *ReconciliationContext) memcachedProbeHandler() corev1.ProbeHandler {
+	spec := rc.Memcached.Spec
+	if spec.TLS.Enable || rc.textProtocolDisabled() ||
+		imageForMemcached(spec.Image) != cachev1.MemcachedDefaultImage {
+		return corev1.ProbeHandler{
+			TCPSocket: &corev1.TCPSocketAction{
+				Port: intstr.FromInt32(spec.ContainerPort),
+			},
+		}
+	}
+
+	return corev1.ProbeHandler{
+		Exec: &corev1.ExecAction{
+			Command: []string{
+				"sh",
+				"-c",
+				fmt.Sprintf(
+					`printf 'version\r\n' | nc -w 1 127.0.0.1 %d | grep -qE '^(VERSION|CLIENT_ERROR unauthenticated)'`,
+					spec.ContainerPort,
+				),
+			},
+		},
+	}
+}
+
+func (rc *ReconciliationContext) memcachedProbes() probeSet {
+	handler := rc.memcachedProbeHandler()
+
+	return probeSet{
+		liveness: &corev1.Probe{
+			ProbeHandler:     handler,
+			PeriodSeconds:    10,
+			TimeoutSeconds:   2,
+			FailureThreshold: 3,
+		},
+		readiness: &corev1.Probe{
+			ProbeHandler:     handler,
+			PeriodSeconds:    5,
+			TimeoutSeconds:   2,
+			FailureThreshold: 2,
+		},
+		// a large extstore file can take a while to open
+		startup: &corev1.Probe{
+			ProbeHandler:     handler,
+			PeriodSeconds:    2,
+			TimeoutSeconds:   2,
+			FailureThreshold: 30,
+		},
+	}.withOverrides(rc.Memcached.Spec.Probes)
+}
+
+// proxyProbes checks the stats port for liveness, twemproxy answers it from the same event loop
+// as the clients, and the listen port for readiness
+func (rc *ReconciliationContext) proxyProbes() probeSet {
+	listenPort := proxyListenPort(proxyConfigWithDefaults(rc.Memcached.Spec.Proxy.Config).Listen)
+
+	stats := corev1.ProbeHandler{
+		TCPSocket: &corev1.TCPSocketAction{
+			Port: intstr.FromInt32(proxyStatsPort),
+		},
+	}
+
+	return probeSet{
+		liveness: &corev1.Probe{
+			ProbeHandler:     stats,
+			PeriodSeconds:    10,
+			TimeoutSeconds:   2,
+			FailureThreshold: 3,
+		},
+		readiness: &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{
+				TCPSocket: &corev1.TCPSocketAction{
+					Port: intstr.FromInt32(listenPort),
+				},
+			},
+			PeriodSeconds:    5,
+			TimeoutSeconds:   2,
+			FailureThreshold: 2,
+		},
+		startup: &corev1.Probe{
+			ProbeHandler:     stats,
+			PeriodSeconds:    2,
+			TimeoutSeconds:   2,
+			FailureThreshold: 15,
+		},
+	}.withOverrides(rc.Memcached.Spec.Proxy.Probes)
+}
+
+func (p probeSet) withOverrides(probes cachev1.Probes) probeSet {
+	return probeSet{
+		liveness:  overrideProbe(p.liveness, probes.Liveness),
+		readiness: overrideProbe(p.readiness, probes.Readiness),
+		startup:   overrideProbe(p.startup, probes.Startup),
+	}
+}
+
+// apply sets the probes on the container
+func (p probeSet) apply(container *corev1.Container) {
+	container.LivenessProbe = p.liveness
+	container.ReadinessProbe = p.readiness
+	container.StartupProbe = p.startup
+}
+
+func overrideProbe(probe *corev1.Probe, overrides *cachev1.ProbeOverrides) *corev1.Probe {
+	if overrides == nil {
+		return probe
+	}
+	if overrides.Disable {
+		return nil
+	}
+
+	if overrides.InitialDelaySeconds != 0 {
+		probe.InitialDelaySeconds = overrides.InitialDelaySeconds
+	}
+	if overrides.PeriodSeconds != 0 {
+		probe.PeriodSeconds = overrides.PeriodSeconds
+	}
+	if overrides.TimeoutSeconds != 0 {
+		probe.TimeoutSeconds = overrides.TimeoutSeconds
+	}
+	if overrides.SuccessThreshold != 0 {
+		probe.SuccessThreshold = overrides.SuccessThreshold
+	}
+	if overrides.FailureThreshold != 0 {
+		probe.FailureThreshold = overrides.FailureThreshold
+	}
+
+	return probe
+}
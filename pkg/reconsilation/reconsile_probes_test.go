@@ -0,0 +1,31 @@
+package reconsilation
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+)
+
+var _ = Describe("Probes", func() {
+	DescribeTable("Should only use the version round trip with the default image",
+		func(spec cachev1.MemcachedSpec, exec bool) {
+			spec.ContainerPort = 11211
+			rc := newTestContext(&cachev1.Memcached{Spec: spec})
+
+			handler := rc.memcachedProbeHandler()
+			Expect(handler.Exec != nil).To(Equal(exec))
+			Expect(handler.TCPSocket != nil).To(Equal(!exec))
+		},
+		Entry("default image", cachev1.MemcachedSpec{}, true),
+		Entry("default image set explicitly", cachev1.MemcachedSpec{
+			Image: cachev1.DockerImage{Name: "memcached", Tag: "1.6.23-alpine"},
+		}, true),
+		Entry("another image", cachev1.MemcachedSpec{
+			Image: cachev1.DockerImage{Name: "registry.example.com/memcached", Tag: "distroless"},
+		}, false),
+		Entry("TLS", cachev1.MemcachedSpec{
+			TLS: cachev1.TLS{Enable: true},
+		}, false),
+	)
+})
@@ -3,23 +3,34 @@ package reconsilation
 import (
 	"fmt"
 	"os"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
 
 	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
 	"github.com/0x0BSoD/memcached-operator/pkg/events"
 )
 
+const (
+	proxyConfigVolumeName = "config"
+	proxyConfigMountPath  = "/etc/config"
+	proxyConfigFileName   = "twem-config.yaml"
+)
+
 // imageForProxy
 // TODO: Repeated code
 func imageForProxy(proxyImage cachev1.DockerImage) string {
@@ -44,6 +55,15 @@ func imageForProxy(proxyImage cachev1.DockerImage) string {
 	return image
 }
 
+// selectorLabelsForProxy is the subset of proxy labels that stays the same for the
+// whole life of a Memcached, used as the Deployment and Service selector
+func selectorLabelsForProxy(name string) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/name":     "Memcachd-Proxy",
+		"app.kubernetes.io/instance": fmt.Sprintf("%s-proxy", name),
+	}
+}
+
 func labelsForProxy(name, image string) map[string]string {
 	return map[string]string{
 		"app.kubernetes.io/name":       "Memcachd-Proxy",
@@ -51,7 +71,178 @@ func labelsForProxy(name, image string) map[string]string {
 		"app.kubernetes.io/version":    strings.Split(image, ":")[1],
 		"app.kubernetes.io/part-of":    "memcached-operator",
 		"app.kubernetes.io/created-by": "controller-manager",
+		"app.kubernetes.io/managed-by": "memcached-operator",
+	}
+}
+
+func configMapNameForProxy(name string) string {
+	return fmt.Sprintf("%s-proxy-config", name)
+}
+
+// proxyConfigWithDefaults returns a copy of the config with every unset field
+// replaced by the twemproxy default
+func proxyConfigWithDefaults(config cachev1.ProxyConfig) cachev1.ProxyConfig {
+	c := *config.DeepCopy()
+
+	if c.Listen == "" {
+		c.Listen = cachev1.ProxyDefaultListen
+	}
+	if c.Hash == "" {
+		c.Hash = cachev1.ProxyDefaultHash
+	}
+	if c.Distribution == "" {
+		c.Distribution = cachev1.ProxyDefaultDistribution
+	}
+	if c.ServerFailureLimit == 0 {
+		c.ServerFailureLimit = cachev1.ProxyDefaultServerFailureLimit
+	}
+	if c.ServerRetryTimeout == 0 {
+		c.ServerRetryTimeout = cachev1.ProxyDefaultServerRetryTimeout
 	}
+	if c.Timeout == 0 {
+		c.Timeout = cachev1.ProxyDefaultTimeout
+	}
+	if c.Servers == nil {
+		c.Servers = []string{}
+	}
+
+	return c
+}
+
+// proxyListenPort extracts the port from a twemproxy listen address (name:port or ip:port)
+func proxyListenPort(listen string) int32 {
+	parts := strings.Split(listen, ":")
+	listenPort, _ := strconv.ParseInt(parts[len(parts)-1], 10, 32)
+	return int32(listenPort)
+}
+
+// serversForProxy builds the twemproxy server list (host:port:weight) from the Memcached pods,
+// sorted so that the rendered config only changes when the membership does.
+// With the StatefulSet topology every ordinal of the StatefulSet replicas is listed by its stable
+// DNS name, whether its pod is up or not, so a restart doesn't reshuffle the keys; otherwise only
+// the ready pods are listed by IP.
+// Pods being decommissioned are left out, unless that would empty the pool. Pods still ramping up
+// get a lower weight, see proxyServerWeights.
+func (rc *ReconciliationContext) serversForProxy() []string {
+	weights, _ := rc.proxyServerWeights()
+
+	servers := rc.serversFromPods(true, weights)
+	if len(servers) == 0 {
+		servers = rc.serversFromPods(false, weights)
+	}
+	return servers
+}
+
+func (rc *ReconciliationContext) serversFromPods(skipDecommissioned bool, weights map[string]int) []string {
+	fullWeight := 1
+	if rc.Memcached.Spec.Proxy.RampUp.Enable {
+		fullWeight = proxyFullWeight
+	}
+	server := func(podName, host string) string {
+		weight, found := weights[podName]
+		if !found {
+			weight = fullWeight
+		}
+		return fmt.Sprintf("%s:%d:%d", host, rc.Memcached.Spec.ContainerPort, weight)
+	}
+
+	servers := []string{}
+	if rc.Memcached.Spec.Topology == cachev1.TopologyStatefulSet {
+		sts := rc.memcachedStatefulSet
+		if sts == nil || sts.Spec.Replicas == nil {
+			return servers
+		}
+
+		decommissioned := map[string]bool{}
+		for _, pod := range rc.memcachedPods {
+			decommissioned[pod.Name] = isPodDecommissioned(pod)
+		}
+		for ordinal := 0; ordinal < int(*sts.Spec.Replicas); ordinal++ {
+			podName := fmt.Sprintf("%s-%d", sts.Name, ordinal)
+			if skipDecommissioned && decommissioned[podName] {
+				continue
+			}
+			servers = append(servers, server(podName, rc.memcachedPodHost(podName)))
+		}
+		sort.Strings(servers)
+
+		return servers
+	}
+
+	for _, pod := range rc.memcachedPods {
+		if pod.GetDeletionTimestamp() != nil || pod.Status.PodIP == "" || !isPodReady(pod) {
+			continue
+		}
+		if skipDecommissioned && isPodDecommissioned(pod) {
+			continue
+		}
+		servers = append(servers, server(pod.Name, pod.Status.PodIP))
+	}
+	sort.Strings(servers)
+
+	return servers
+}
+
+// proxyServers returns the servers of the pool, the ones set in the spec or the memcached pods
+func (rc *ReconciliationContext) proxyServers() []string {
+	if servers := rc.Memcached.Spec.Proxy.Config.Servers; len(servers) != 0 {
+		return servers
+	}
+	return rc.serversForProxy()
+}
+
+// buildProxyConfig renders the twemproxy configuration file with a single server pool
+// named after the Memcached resource
+func (rc *ReconciliationContext) buildProxyConfig() (string, error) {
+	rc.ReqLogger.Info("[reconcile_proxy] buildProxyConfig")
+
+	config := proxyConfigWithDefaults(rc.Memcached.Spec.Proxy.Config)
+	config.Servers = rc.proxyServers()
+
+	pools := map[string]cachev1.ProxyConfig{
+		rc.Memcached.Name: config,
+	}
+
+	out, err := yaml.Marshal(pools)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+func (rc *ReconciliationContext) configMapForProxy() (*corev1.ConfigMap, error) {
+	rc.ReqLogger.Info("[reconcile_proxy] configMapForProxy")
+
+	image := imageForProxy(rc.Memcached.Spec.Proxy.Image)
+	ls := labelsForProxy(rc.Memcached.Name, image)
+
+	config, err := rc.buildProxyConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]string{
+		proxyConfigFileName: config,
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      configMapNameForProxy(rc.Memcached.Name),
+			Namespace: rc.Memcached.Namespace,
+			Labels:    ls,
+			Annotations: map[string]string{
+				cachev1.ProxyConfigHashAnnotation: hashConfigMapData(data),
+			},
+		},
+		Data: data,
+	}
+
+	if err := ctrl.SetControllerReference(rc.Memcached, cm, rc.Scheme); err != nil {
+		return nil, err
+	}
+
+	return cm, nil
 }
 
 func (rc *ReconciliationContext) serviceForProxy() (*corev1.Service, error) {
@@ -60,28 +251,26 @@ func (rc *ReconciliationContext) serviceForProxy() (*corev1.Service, error) {
 	image := imageForProxy(rc.Memcached.Spec.Proxy.Image)
 	ls := labelsForProxy(rc.Memcached.Name, image)
 
-	listenPort, _ := strconv.ParseInt(
-		strings.Split(rc.Memcached.Spec.Proxy.Config.Listen, ":")[1],
-		10,
-		32,
-	)
+	listenPort := proxyListenPort(proxyConfigWithDefaults(rc.Memcached.Spec.Proxy.Config).Listen)
 
 	svc := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      fmt.Sprintf("%s-proxy", rc.Memcached.Name),
 			Namespace: rc.Memcached.Namespace,
+			Labels:    ls,
 		},
 		Spec: corev1.ServiceSpec{
-			Ports: []corev1.ServicePort{
+			Ports: append([]corev1.ServicePort{
 				{
 					Name: "proxy",
-					Port: int32(listenPort),
+					Port: listenPort,
 				},
-			},
-			Selector: ls,
+			}, rc.metricsServicePort(proxyExporterPort)...),
+			Selector: selectorLabelsForProxy(rc.Memcached.Name),
 			Type:     corev1.ServiceTypeClusterIP,
 		},
 	}
+	applyServiceSpec(svc, rc.Memcached.Spec.Proxy.Service)
 
 	if err := ctrl.SetControllerReference(rc.Memcached, svc, rc.Scheme); err != nil {
 		return nil, err
@@ -97,25 +286,28 @@ func (rc *ReconciliationContext) deploymentForProxy() (*appsv1.Deployment, error
 	ls := labelsForProxy(rc.Memcached.Name, image)
 	replicas := rc.Memcached.Spec.Proxy.Replicas
 
-	listenPort, _ := strconv.ParseInt(
-		strings.Split(rc.Memcached.Spec.Proxy.Config.Listen, ":")[1],
-		10,
-		32,
-	)
+	listenPort := proxyListenPort(proxyConfigWithDefaults(rc.Memcached.Spec.Proxy.Config).Listen)
+
+	annotations := map[string]string{}
+	if rc.proxyConfigMap != nil {
+		annotations[cachev1.ProxyConfigHashAnnotation] = hashConfigMapData(rc.proxyConfigMap.Data)
+	}
 
 	dep := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      fmt.Sprintf("%s-proxy", rc.Memcached.Name),
 			Namespace: rc.Memcached.Namespace,
+			Labels:    ls,
 		},
 		Spec: appsv1.DeploymentSpec{
 			Replicas: &replicas,
 			Selector: &metav1.LabelSelector{
-				MatchLabels: ls,
+				MatchLabels: selectorLabelsForProxy(rc.Memcached.Name),
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: ls,
+					Labels:      ls,
+					Annotations: annotations,
 				},
 				Spec: corev1.PodSpec{
 					Affinity: &corev1.Affinity{
@@ -165,24 +357,50 @@ func (rc *ReconciliationContext) deploymentForProxy() (*appsv1.Deployment, error
 								},
 							},
 						},
-						Ports: []corev1.ContainerPort{{
-							ContainerPort: int32(listenPort),
-							Name:          "proxy",
-						}},
+						Ports: []corev1.ContainerPort{
+							{
+								ContainerPort: listenPort,
+								Name:          "proxy",
+							},
+							{
+								ContainerPort: proxyStatsPort,
+								Name:          "stats",
+							},
+						},
 						Command: []string{
 							"nutcracker",
 							"-c",
-							"/etc/config/twem-config.yaml",
+							fmt.Sprintf("%s/%s", proxyConfigMountPath, proxyConfigFileName),
 							"-v",
 							"7",
 						},
 						Resources: rc.Memcached.Spec.Proxy.Resources,
+						VolumeMounts: []corev1.VolumeMount{{
+							Name:      proxyConfigVolumeName,
+							MountPath: proxyConfigMountPath,
+							ReadOnly:  true,
+						}},
+					}},
+					Volumes: []corev1.Volume{{
+						Name: proxyConfigVolumeName,
+						VolumeSource: corev1.VolumeSource{
+							ConfigMap: &corev1.ConfigMapVolumeSource{
+								LocalObjectReference: corev1.LocalObjectReference{
+									Name: configMapNameForProxy(rc.Memcached.Name),
+								},
+							},
+						},
 					}},
 				},
 			},
 		},
 	}
 
+	rc.proxyProbes().apply(&dep.Spec.Template.Spec.Containers[0])
+	addDefaultScheduling(&dep.Spec.Template.Spec, selectorLabelsForProxy(rc.Memcached.Name))
+	rc.addProxyExporter(&dep.Spec.Template)
+	applyPodTemplate(&dep.Spec.Template, rc.Memcached.Spec.Proxy.PodTemplate)
+
 	if err := ctrl.SetControllerReference(rc.Memcached, dep, rc.Scheme); err != nil {
 		return nil, err
 	}
@@ -192,40 +410,31 @@ func (rc *ReconciliationContext) deploymentForProxy() (*appsv1.Deployment, error
 
 func (rc *ReconciliationContext) CheckProxyDeploymentScaling() ReconcileResult {
 	logger := rc.ReqLogger
-	m := rc.Memcached
-	dep := rc.memcachedDeployment
+	dep := rc.proxyDeployment
 
-	if dep == nil {
+	if dep == nil || !rc.Memcached.Spec.Proxy.Enable {
 		return Continue()
 	}
 
 	logger.Info("[reconcile_proxy] CheckProxyDeploymentScaling")
 
-	desiredReplicas := rc.Memcached.Spec.Size
+	desiredReplicas := rc.Memcached.Spec.Proxy.Replicas
 	currentReplicas := *dep.Spec.Replicas
 
 	if currentReplicas != desiredReplicas {
-		mPatch := client.MergeFrom(m.DeepCopy())
-
-		err := rc.Client.Status().Patch(rc.Ctx, m, mPatch)
-		if err != nil {
-			logger.Error(err, "error patching proxy for scaling")
-			return Error(err)
-		}
-
 		rc.ReqLogger.Info(
 			"Need to update the proxy's replicas",
-			"Memcached-Proxy", m.Name,
+			"Memcached-Proxy", dep.Name,
 			"currentReplicas", currentReplicas,
 			"desiredReplicas", desiredReplicas,
 		)
 
 		if currentReplicas > desiredReplicas {
-			rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.ScalingDown,
-				"Scaling Down %s", m.Name)
+			rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.ProxyScalingDown,
+				"Scaling down %s from %d to %d", dep.Name, currentReplicas, desiredReplicas)
 		} else if currentReplicas < desiredReplicas {
-			rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.ScalingUp,
-				"Scaling Up %s", m.Name)
+			rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.ProxyScalingUp,
+				"Scaling up %s from %d to %d", dep.Name, currentReplicas, desiredReplicas)
 		}
 
 		if err := setOperatorProgressStatus(rc, cachev1.ProgressUpdating); err != nil {
@@ -235,14 +444,49 @@ func (rc *ReconciliationContext) CheckProxyDeploymentScaling() ReconcileResult {
 		patch := client.MergeFrom(dep.DeepCopy())
 		dep.Spec.Replicas = &desiredReplicas
 		if err := rc.Client.Patch(rc.Ctx, dep, patch); err != nil {
+			logger.Error(err, "error patching proxy for scaling")
 			return Error(err)
 		}
 	}
 
+	if err := setProxyStatus(rc, desiredReplicas, dep.Status.ReadyReplicas, dep.Status.AvailableReplicas); err != nil {
+		return Error(err)
+	}
+
 	return Continue()
 }
 
+func setProxyStatus(rc *ReconciliationContext, replicas, readyReplicas, availableReplicas int32) error {
+	rc.ReqLogger.Info("[reconcile_proxy] setProxyStatus")
+
+	newStatus := cachev1.ProxyStatus{
+		Replicas:          replicas,
+		ReadyReplicas:     readyReplicas,
+		AvailableReplicas: availableReplicas,
+	}
+	if rc.Memcached.Spec.Proxy.Enable {
+		newStatus.Ready = fmt.Sprintf("%d/%d", readyReplicas, replicas)
+	}
+	if rc.Memcached.Status.Proxy == newStatus {
+		// early return, no need to ping k8s
+		return nil
+	}
+
+	patch := client.MergeFrom(rc.Memcached.DeepCopy())
+	rc.Memcached.Status.Proxy = newStatus
+	if err := rc.Client.Status().Patch(rc.Ctx, rc.Memcached, patch); err != nil {
+		rc.ReqLogger.Error(err, "error updating the Memcached proxy status")
+		return err
+	}
+
+	return nil
+}
+
 func (rc *ReconciliationContext) CheckProxyDeploymentCreation() ReconcileResult {
+	if !rc.Memcached.Spec.Proxy.Enable {
+		return Continue()
+	}
+
 	rc.ReqLogger.Info("[reconcile_proxy] CheckProxyDeploymentCreation")
 
 	// Check if the desired Deployment already exists
@@ -254,6 +498,14 @@ func (rc *ReconciliationContext) CheckProxyDeploymentCreation() ReconcileResult
 		}, currentDeployment)
 
 	if errors.IsNotFound(err) {
+		// twemproxy crash-loops without its config, see CheckProxyConfigMapCreation
+		if rc.proxyConfigMap == nil {
+			rc.ReqLogger.Info(
+				"Waiting for the proxy config before creating a Deployment for",
+				"Memcached-Proxy", rc.Memcached.Name)
+			return Continue()
+		}
+
 		rc.ReqLogger.Info(
 			"Creating a new Deployment for",
 			"Memcached-Proxy", rc.Memcached.Name)
@@ -275,6 +527,11 @@ func (rc *ReconciliationContext) CheckProxyDeploymentCreation() ReconcileResult
 
 		rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.CreatedResource,
 			"Created Deployment %s", dep.Name)
+
+		if err := setCondition(rc, cachev1.MemcachedProxy, metav1.ConditionTrue, "Enabling",
+			fmt.Sprintf("Created Deployment %s", dep.Name)); err != nil {
+			return Error(err)
+		}
 		return Continue()
 	} else if err != nil {
 		rc.ReqLogger.Error(
@@ -320,8 +577,15 @@ func (rc *ReconciliationContext) CheckProxyServiceCreation() ReconcileResult {
 			return Error(err)
 		}
 
+		rc.proxyService = svc
+
 		rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.CreatedResource,
 			"Created Service %s", svc.Name)
+
+		if err := setCondition(rc, cachev1.MemcachedProxy, metav1.ConditionTrue, "Enabling",
+			fmt.Sprintf("Created Service %s", svc.Name)); err != nil {
+			return Error(err)
+		}
 		return Continue()
 	} else if err != nil {
 		rc.ReqLogger.Error(
@@ -331,5 +595,267 @@ func (rc *ReconciliationContext) CheckProxyServiceCreation() ReconcileResult {
 		return Error(err)
 	}
 
+	rc.proxyService = currentService
+
+	return Continue()
+}
+
+func (rc *ReconciliationContext) CheckProxyConfigMapCreation() ReconcileResult {
+	if !rc.Memcached.Spec.Proxy.Enable {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_proxy] CheckProxyConfigMapCreation")
+
+	// twemproxy doesn't start with an empty pool, the config waits for a memcached backend
+	hasServers := len(rc.proxyServers()) != 0
+
+	desiredConfigMap, err := rc.configMapForProxy()
+	if err != nil {
+		return Error(err)
+	}
+
+	currentConfigMap := &corev1.ConfigMap{}
+	err = rc.Client.Get(rc.Ctx,
+		types.NamespacedName{
+			Name:      desiredConfigMap.Name,
+			Namespace: rc.Memcached.Namespace,
+		}, currentConfigMap)
+	if errors.IsNotFound(err) {
+		// The proxy Deployment waits for the ConfigMap, the pods becoming ready bring the
+		// reconcile back and the memcached steps further down still have to run meanwhile
+		if !hasServers {
+			rc.ReqLogger.Info(
+				"Waiting for a memcached backend before creating the ConfigMap for",
+				"Memcached-Proxy", rc.Memcached.Name)
+			return Continue()
+		}
+
+		rc.ReqLogger.Info(
+			"Creating a new ConfigMap for",
+			"Memcached-Proxy", rc.Memcached.Name)
+
+		if err := setOperatorProgressStatus(rc, cachev1.ProgressUpdating); err != nil {
+			return Error(err)
+		}
+
+		if err := rc.Client.Create(rc.Ctx, desiredConfigMap); err != nil {
+			return Error(err)
+		}
+
+		rc.proxyConfigMap = desiredConfigMap
+
+		rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.CreatedResource,
+			"Created ConfigMap %s", desiredConfigMap.Name)
+
+		if err := setCondition(rc, cachev1.MemcachedProxy, metav1.ConditionTrue, "Enabling",
+			fmt.Sprintf("Created ConfigMap %s", desiredConfigMap.Name)); err != nil {
+			return Error(err)
+		}
+		return Continue()
+	} else if err != nil {
+		rc.ReqLogger.Error(
+			err,
+			"Could not locate ConfigMap for",
+			"Memcached-Proxy", rc.Memcached.Name)
+		return Error(err)
+	}
+
+	rc.proxyConfigMap = currentConfigMap
+
+	// The last config with backends is kept
+	if !hasServers {
+		rc.ReqLogger.Info(
+			"No memcached backend, keeping the config of",
+			"Memcached-Proxy", rc.Memcached.Name)
+		return Continue()
+	}
+
+	if !reflect.DeepEqual(currentConfigMap.Data, desiredConfigMap.Data) ||
+		!equality.Semantic.DeepDerivative(desiredConfigMap.Labels, currentConfigMap.Labels) ||
+		!equality.Semantic.DeepDerivative(desiredConfigMap.Annotations, currentConfigMap.Annotations) {
+		rc.ReqLogger.Info(
+			"Need to update the proxy's config",
+			"Memcached-Proxy", rc.Memcached.Name)
+
+		if err := setOperatorProgressStatus(rc, cachev1.ProgressUpdating); err != nil {
+			return Error(err)
+		}
+
+		// The hash annotation records the data last written by the operator, anything else is an edit from outside
+		editedOutOfBand := currentConfigMap.Annotations[cachev1.ProxyConfigHashAnnotation] != hashConfigMapData(currentConfigMap.Data)
+
+		patch := client.MergeFrom(currentConfigMap.DeepCopy())
+		currentConfigMap.Labels = mergeStringMaps(currentConfigMap.Labels, desiredConfigMap.Labels)
+		currentConfigMap.Annotations = mergeStringMaps(currentConfigMap.Annotations, desiredConfigMap.Annotations)
+		currentConfigMap.Data = desiredConfigMap.Data
+		if err := rc.Client.Patch(rc.Ctx, currentConfigMap, patch); err != nil {
+			return Error(err)
+		}
+
+		if editedOutOfBand {
+			rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.DriftCorrected,
+				"Corrected drift in ConfigMap %s: data", currentConfigMap.Name)
+		} else {
+			rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.UpdatedResource,
+				"Updated ConfigMap %s", currentConfigMap.Name)
+		}
+	}
+
 	return Continue()
 }
+
+// CheckProxyConfigRollout restarts the proxy pods when the rendered config changes,
+// twemproxy only reads its config on startup. The ConfigMap is never written with an empty pool,
+// see CheckProxyConfigMapCreation, so a rollout always lands on a config with backends
+func (rc *ReconciliationContext) CheckProxyConfigRollout() ReconcileResult {
+	dep := rc.proxyDeployment
+
+	if dep == nil || rc.proxyConfigMap == nil {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_proxy] CheckProxyConfigRollout")
+
+	desiredHash := hashConfigMapData(rc.proxyConfigMap.Data)
+	if dep.Spec.Template.Annotations[cachev1.ProxyConfigHashAnnotation] == desiredHash {
+		return Continue()
+	}
+
+	if err := setOperatorProgressStatus(rc, cachev1.ProgressUpdating); err != nil {
+		return Error(err)
+	}
+
+	patch := client.MergeFrom(dep.DeepCopy())
+	if dep.Spec.Template.Annotations == nil {
+		dep.Spec.Template.Annotations = map[string]string{}
+	}
+	dep.Spec.Template.Annotations[cachev1.ProxyConfigHashAnnotation] = desiredHash
+	if err := rc.Client.Patch(rc.Ctx, dep, patch); err != nil {
+		return Error(err)
+	}
+
+	rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.RollingRestart,
+		"Restarting Deployment %s to apply the new proxy config", dep.Name)
+
+	return Continue()
+}
+
+// CheckProxyTeardown removes the proxy Deployment, Services and ConfigMap once the proxy is disabled
+func (rc *ReconciliationContext) CheckProxyTeardown() ReconcileResult {
+	if rc.Memcached.Spec.Proxy.Enable {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_proxy] CheckProxyTeardown")
+
+	name := fmt.Sprintf("%s-proxy", rc.Memcached.Name)
+	owned := []ownedObject{
+		{"Deployment", name, &appsv1.Deployment{}},
+		{"Service", name, &corev1.Service{}},
+		{"Service", headlessServiceNameForProxy(rc.Memcached.Name), &corev1.Service{}},
+		{"ConfigMap", configMapNameForProxy(rc.Memcached.Name), &corev1.ConfigMap{}},
+		{"PodDisruptionBudget", name, &policyv1.PodDisruptionBudget{}},
+	}
+
+	deleted := false
+	for _, o := range owned {
+		found, err := rc.deleteOwnedObject(o.obj, o.name)
+		if err != nil {
+			rc.ReqLogger.Error(
+				err,
+				"Could not delete "+o.kind+" for",
+				"Memcached-Proxy", rc.Memcached.Name)
+			return Error(err)
+		}
+		if !found {
+			continue
+		}
+
+		rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.DeletedResource,
+			"Deleted %s %s", o.kind, o.name)
+		deleted = true
+	}
+
+	rc.proxyDeployment = nil
+	rc.proxyService = nil
+	rc.proxyConfigMap = nil
+
+	// The progress, proxy status and condition land in a single status patch, the deleted objects
+	// are reported through events
+	patch := client.MergeFrom(rc.Memcached.DeepCopy())
+	changed := rc.Memcached.Status.SetCondition(metav1.Condition{
+		Type:               string(cachev1.MemcachedProxy),
+		Status:             metav1.ConditionFalse,
+		Reason:             "Disabled",
+		Message:            "Proxy is disabled",
+		ObservedGeneration: rc.Memcached.Generation,
+	})
+	if deleted && rc.Memcached.Status.OperatorProgress != cachev1.ProgressUpdating {
+		rc.Memcached.Status.OperatorProgress = cachev1.ProgressUpdating
+		changed = true
+	}
+	if rc.Memcached.Status.Proxy != (cachev1.ProxyStatus{}) {
+		rc.Memcached.Status.Proxy = cachev1.ProxyStatus{}
+		changed = true
+	}
+	if !changed {
+		return Continue()
+	}
+
+	if err := rc.Client.Status().Patch(rc.Ctx, rc.Memcached, patch); err != nil {
+		rc.ReqLogger.Error(err, "error updating the Memcached proxy status")
+		return Error(err)
+	}
+
+	return Continue()
+}
+
+// CheckProxyEnabled marks the proxy as enabled once all of its resources are in place
+func (rc *ReconciliationContext) CheckProxyEnabled() ReconcileResult {
+	if !rc.Memcached.Spec.Proxy.Enable || rc.proxyDeployment == nil {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_proxy] CheckProxyEnabled")
+
+	if err := setCondition(rc, cachev1.MemcachedProxy, metav1.ConditionTrue, "Enabled",
+		"Proxy is enabled"); err != nil {
+		return Error(err)
+	}
+
+	return Continue()
+}
+
+// CheckProxyDeploymentDrift brings the proxy Deployment back in line with the Memcached spec,
+// replicas are left to CheckProxyDeploymentScaling
+func (rc *ReconciliationContext) CheckProxyDeploymentDrift() ReconcileResult {
+	if rc.proxyDeployment == nil || !rc.Memcached.Spec.Proxy.Enable {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_proxy] CheckProxyDeploymentDrift")
+
+	desiredDeployment, err := rc.deploymentForProxy()
+	if err != nil {
+		return Error(err)
+	}
+
+	return rc.updateDeploymentIfDrifted(rc.proxyDeployment, desiredDeployment)
+}
+
+// CheckProxyServiceDrift brings the proxy Service back in line with the Memcached spec
+func (rc *ReconciliationContext) CheckProxyServiceDrift() ReconcileResult {
+	if rc.proxyService == nil || !rc.Memcached.Spec.Proxy.Enable {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_proxy] CheckProxyServiceDrift")
+
+	desiredService, err := rc.serviceForProxy()
+	if err != nil {
+		return Error(err)
+	}
+
+	return rc.updateServiceIfDrifted(rc.proxyService, desiredService)
+}
@@ -0,0 +1,244 @@
+package reconsilation
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+)
+
+// memcachedPod returns a scheduled memcached pod, ready when ready is set
+func memcachedPod(name, ip string, ready bool) *corev1.Pod {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour)),
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			PodIP: ip,
+			Conditions: []corev1.PodCondition{{
+				Type:               corev1.PodReady,
+				Status:             status,
+				LastTransitionTime: metav1.NewTime(time.Now().Add(-time.Hour)),
+			}},
+		},
+	}
+}
+
+func decommissioned(pod *corev1.Pod) *corev1.Pod {
+	pod.Annotations = map[string]string{cachev1.DecommissionAnnotation: time.Now().UTC().Format(time.RFC3339)}
+	return pod
+}
+
+func proxyMemcached() *cachev1.Memcached {
+	return &cachev1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "cache", Namespace: "default"},
+		Spec: cachev1.MemcachedSpec{
+			Size:          3,
+			ContainerPort: 11211,
+			Proxy:         cachev1.Proxy{Enable: true, Replicas: 1},
+		},
+	}
+}
+
+var _ = Describe("Proxy", func() {
+	DescribeTable("Should list the ready pods as the servers",
+		func(pods []*corev1.Pod, expected []string) {
+			rc := newTestContext(proxyMemcached())
+			rc.memcachedPods = pods
+
+			Expect(rc.serversForProxy()).To(Equal(expected))
+		},
+		Entry("no pods", nil, []string{}),
+		Entry("sorted by address", []*corev1.Pod{
+			memcachedPod("cache-b", "10.0.0.2", true),
+			memcachedPod("cache-a", "10.0.0.1", true),
+		}, []string{"10.0.0.1:11211:1", "10.0.0.2:11211:1"}),
+		Entry("without the pods that aren't ready or have no IP", []*corev1.Pod{
+			memcachedPod("cache-a", "10.0.0.1", true),
+			memcachedPod("cache-b", "10.0.0.2", false),
+			memcachedPod("cache-c", "", true),
+		}, []string{"10.0.0.1:11211:1"}),
+		Entry("without the decommissioned pods", []*corev1.Pod{
+			memcachedPod("cache-a", "10.0.0.1", true),
+			decommissioned(memcachedPod("cache-b", "10.0.0.2", true)),
+		}, []string{"10.0.0.1:11211:1"}),
+		Entry("with the decommissioned pods when nothing else is left", []*corev1.Pod{
+			decommissioned(memcachedPod("cache-a", "10.0.0.1", true)),
+		}, []string{"10.0.0.1:11211:1"}),
+	)
+
+	DescribeTable("Should list every StatefulSet ordinal by its DNS name",
+		func(replicas int32, pods []*corev1.Pod, expected []string) {
+			m := proxyMemcached()
+			m.Spec.Topology = cachev1.TopologyStatefulSet
+			rc := newTestContext(m)
+			rc.memcachedStatefulSet = &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "cache", Namespace: "default"},
+				Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+			}
+			rc.memcachedPods = pods
+
+			Expect(rc.serversForProxy()).To(Equal(expected))
+		},
+		Entry("no replicas", int32(0), nil, []string{}),
+		Entry("whether the pods are up or not", int32(3), []*corev1.Pod{
+			memcachedPod("cache-0", "10.0.0.1", true),
+			memcachedPod("cache-1", "", false),
+		}, []string{
+			"cache-0.cache-headless.default.svc:11211:1",
+			"cache-1.cache-headless.default.svc:11211:1",
+			"cache-2.cache-headless.default.svc:11211:1",
+		}),
+		Entry("without the ordinals being decommissioned", int32(3), []*corev1.Pod{
+			memcachedPod("cache-0", "10.0.0.1", true),
+			memcachedPod("cache-1", "10.0.0.2", true),
+			decommissioned(memcachedPod("cache-2", "10.0.0.3", true)),
+		}, []string{
+			"cache-0.cache-headless.default.svc:11211:1",
+			"cache-1.cache-headless.default.svc:11211:1",
+		}),
+		Entry("without the pods left over above the replicas", int32(1), []*corev1.Pod{
+			memcachedPod("cache-0", "10.0.0.1", true),
+			memcachedPod("cache-1", "10.0.0.2", true),
+		}, []string{
+			"cache-0.cache-headless.default.svc:11211:1",
+		}),
+	)
+
+	It("Should render a single pool named after the Memcached", func() {
+		rc := newTestContext(proxyMemcached())
+		rc.memcachedPods = []*corev1.Pod{memcachedPod("cache-a", "10.0.0.1", true)}
+
+		Expect(rc.buildProxyConfig()).To(MatchYAML(`
+cache:
+  listen: 0.0.0.0:11211
+  hash: fnv1a_64
+  distribution: ketama
+  auto_eject_hosts: false
+  server_failure_limit: 2
+  server_retry_timeout: 30000
+  timeout: 400
+  servers:
+  - 10.0.0.1:11211:1
+`))
+	})
+
+	It("Should render the servers set in the spec instead of the pods", func() {
+		m := proxyMemcached()
+		m.Spec.Proxy.Config = cachev1.ProxyConfig{
+			Listen:       "0.0.0.0:22122",
+			Distribution: "modula",
+			Servers:      []string{"memcached.example.com:11211:1"},
+		}
+		rc := newTestContext(m)
+		rc.memcachedPods = []*corev1.Pod{memcachedPod("cache-a", "10.0.0.1", true)}
+
+		Expect(rc.buildProxyConfig()).To(MatchYAML(`
+cache:
+  listen: 0.0.0.0:22122
+  hash: fnv1a_64
+  distribution: modula
+  auto_eject_hosts: false
+  server_failure_limit: 2
+  server_retry_timeout: 30000
+  timeout: 400
+  servers:
+  - memcached.example.com:11211:1
+`))
+		Expect(proxyListenPort(m.Spec.Proxy.Config.Listen)).To(Equal(int32(22122)))
+	})
+
+	It("Should wait for a backend before creating the config and the Deployment", func() {
+		rc := newTestContext(proxyMemcached())
+		rc.memcachedPods = []*corev1.Pod{memcachedPod("cache-a", "10.0.0.1", false)}
+
+		Expect(rc.CheckProxyConfigMapCreation().Completed()).To(BeFalse())
+		Expect(rc.proxyConfigMap).To(BeNil())
+		Expect(rc.CheckProxyDeploymentCreation().Completed()).To(BeFalse())
+		Expect(rc.proxyDeployment).To(BeNil())
+
+		err := rc.Client.Get(rc.Ctx, types.NamespacedName{
+			Name:      configMapNameForProxy("cache"),
+			Namespace: "default",
+		}, &corev1.ConfigMap{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+
+		By("creating both once a pod is ready")
+		rc.memcachedPods = []*corev1.Pod{memcachedPod("cache-a", "10.0.0.1", true)}
+		Expect(rc.CheckProxyConfigMapCreation().Completed()).To(BeFalse())
+		Expect(rc.proxyConfigMap).NotTo(BeNil())
+		Expect(rc.CheckProxyDeploymentCreation().Completed()).To(BeFalse())
+		Expect(rc.proxyDeployment).NotTo(BeNil())
+	})
+
+	It("Should keep the last config when the backends are gone", func() {
+		rc := newTestContext(proxyMemcached())
+		rc.memcachedPods = []*corev1.Pod{memcachedPod("cache-a", "10.0.0.1", true)}
+		Expect(rc.CheckProxyConfigMapCreation().Completed()).To(BeFalse())
+		data := rc.proxyConfigMap.Data
+
+		rc.memcachedPods = nil
+		Expect(rc.CheckProxyConfigMapCreation().Completed()).To(BeFalse())
+		Expect(rc.proxyConfigMap.Data).To(Equal(data))
+	})
+
+	It("Should tear the proxy down with a single status patch", func() {
+		m := proxyMemcached()
+		m.UID = "uid"
+		m.Spec.Proxy.Enable = false
+		m.Status.Proxy = cachev1.ProxyStatus{Replicas: 1, ReadyReplicas: 1, Ready: "1/1"}
+		owner := []metav1.OwnerReference{*metav1.NewControllerRef(m, cachev1.GroupVersion.WithKind("Memcached"))}
+		rc := newTestContext(m,
+			&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+				Name: "cache-proxy", Namespace: "default", OwnerReferences: owner}},
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Name: configMapNameForProxy("cache"), Namespace: "default", OwnerReferences: owner}},
+		)
+
+		patches := 0
+		rc.Client = interceptor.NewClient(rc.Client.(client.WithWatch), interceptor.Funcs{
+			SubResourcePatch: func(ctx context.Context, c client.Client, subResource string,
+				obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+				patches++
+				return c.SubResource(subResource).Patch(ctx, obj, patch, opts...)
+			},
+		})
+
+		Expect(rc.CheckProxyTeardown().Completed()).To(BeFalse())
+		Expect(patches).To(Equal(1))
+
+		condition, found := rc.Memcached.GetCondition(cachev1.MemcachedProxy)
+		Expect(found).To(BeTrue())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal("Disabled"))
+		Expect(rc.Memcached.Status.Proxy).To(Equal(cachev1.ProxyStatus{}))
+		Expect(rc.Memcached.Status.OperatorProgress).To(Equal(cachev1.ProgressUpdating))
+
+		err := rc.Client.Get(rc.Ctx, types.NamespacedName{Name: "cache-proxy", Namespace: "default"},
+			&appsv1.Deployment{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+
+		By("not patching again once everything is gone")
+		Expect(rc.CheckProxyTeardown().Completed()).To(BeFalse())
+		Expect(patches).To(Equal(1))
+	})
+})
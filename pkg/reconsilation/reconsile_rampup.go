@@ -0,0 +1,94 @@
+package reconsilation
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// proxyFullWeight is the weight of a warm backend when the ramp-up is on, the ramp-up weights are
+// percentages of it. Without the ramp-up every backend keeps weight 1, a different weight would
+// remap the keys of the modula distribution
+const proxyFullWeight = 100
+
+// podReadySince returns when the pod became ready, nil when it isn't
+func podReadySince(pod *corev1.Pod) *time.Time {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue {
+			return &condition.LastTransitionTime.Time
+		}
+	}
+	return nil
+}
+
+// proxyServerWeights returns the twemproxy weight of every memcached pod still ramping up, together
+// with the time until the next weight change. Pods missing from the map get the full weight.
+// When no pod is warm yet, nothing is gained by ramping, all pods start at the full weight
+func (rc *ReconciliationContext) proxyServerWeights() (map[string]int, time.Duration) {
+	proxy := rc.Memcached.Spec.Proxy
+	if !proxy.RampUp.Enable {
+		return nil, 0
+	}
+
+	weights := proxy.RampUpWeights()
+	interval := proxy.RampUpStepInterval()
+	now := time.Now()
+
+	ramping := map[string]int{}
+	var next time.Duration
+	warm := false
+	for _, pod := range rc.memcachedPods {
+		if pod.GetDeletionTimestamp() != nil {
+			continue
+		}
+
+		since := podReadySince(pod)
+		if since == nil {
+			ramping[pod.Name] = int(weights[0])
+			continue
+		}
+
+		elapsed := now.Sub(*since)
+		step := int(elapsed / interval)
+		if step >= len(weights) {
+			warm = true
+			continue
+		}
+
+		ramping[pod.Name] = int(weights[step])
+		if left := time.Duration(step+1)*interval - elapsed; next == 0 || left < next {
+			next = left
+		}
+	}
+
+	if !warm {
+		return nil, 0
+	}
+	return ramping, next
+}
+
+// CheckProxyRampUp makes the reconcile come back at the next ramp-up step, the proxy config is regenerated with the
+// raised weights and rolled out by CheckProxyConfigRollout
+func (rc *ReconciliationContext) CheckProxyRampUp() ReconcileResult {
+	proxy := rc.Memcached.Spec.Proxy
+	if !proxy.Enable || !proxy.RampUp.Enable || len(proxy.Config.Servers) != 0 {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_rampup] CheckProxyRampUp")
+
+	ramping, next := rc.proxyServerWeights()
+	if len(ramping) == 0 || next <= 0 {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info(
+		"Proxy backends are ramping up",
+		"Memcached", rc.Memcached.Name,
+		"backends", len(ramping),
+		"nextStep", next.String(),
+	)
+
+	rc.requeueWithin(next)
+	return Continue()
+}
@@ -0,0 +1,88 @@
+package reconsilation
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+)
+
+// readyFor returns a memcached pod that became ready d ago
+func readyFor(name string, d time.Duration) *corev1.Pod {
+	pod := memcachedPod(name, "10.0.0.1", true)
+	pod.Status.Conditions[0].LastTransitionTime = metav1.NewTime(time.Now().Add(-d))
+	return pod
+}
+
+func rampUpMemcached() *cachev1.Memcached {
+	m := proxyMemcached()
+	m.Spec.Proxy.RampUp = cachev1.RampUp{Enable: true}
+	return m
+}
+
+var _ = Describe("RampUp", func() {
+	DescribeTable("Should weight the backends by the time since they became ready",
+		func(pods []*corev1.Pod, expected map[string]int, next time.Duration) {
+			rc := newTestContext(rampUpMemcached())
+			rc.memcachedPods = pods
+
+			weights, actualNext := rc.proxyServerWeights()
+			Expect(weights).To(Equal(expected))
+			Expect(actualNext).To(BeNumerically("~", next, time.Second))
+		},
+		Entry("no warm pod", []*corev1.Pod{
+			readyFor("cache-a", 30*time.Second),
+			memcachedPod("cache-b", "10.0.0.2", false),
+		}, nil, time.Duration(0)),
+		Entry("a pod that isn't ready starts at the first weight", []*corev1.Pod{
+			readyFor("cache-a", time.Hour),
+			memcachedPod("cache-b", "10.0.0.2", false),
+		}, map[string]int{"cache-b": 10}, time.Duration(0)),
+		Entry("the step counted from the Ready transition", []*corev1.Pod{
+			readyFor("cache-a", time.Hour),
+			readyFor("cache-b", 90*time.Second),
+		}, map[string]int{"cache-b": 25}, 30*time.Second),
+		Entry("the next step of the pod closest to it", []*corev1.Pod{
+			readyFor("cache-a", time.Hour),
+			readyFor("cache-b", 90*time.Second),
+			readyFor("cache-c", 170*time.Second),
+		}, map[string]int{"cache-b": 25, "cache-c": 50}, 10*time.Second),
+		Entry("without the pods being deleted", []*corev1.Pod{
+			readyFor("cache-a", time.Hour),
+			deletingPod(readyFor("cache-b", 10*time.Second)),
+		}, map[string]int{}, time.Duration(0)),
+	)
+
+	It("Should not weight the backends without the ramp-up", func() {
+		rc := newTestContext(proxyMemcached())
+		rc.memcachedPods = []*corev1.Pod{
+			readyFor("cache-a", time.Hour),
+			readyFor("cache-b", 10*time.Second),
+		}
+
+		weights, next := rc.proxyServerWeights()
+		Expect(weights).To(BeNil())
+		Expect(next).To(BeZero())
+	})
+
+	It("Should come back at the next step without stopping the reconcile", func() {
+		rc := newTestContext(rampUpMemcached())
+		rc.memcachedPods = []*corev1.Pod{
+			readyFor("cache-a", time.Hour),
+			readyFor("cache-b", 90*time.Second),
+		}
+
+		Expect(rc.CheckProxyRampUp().Completed()).To(BeFalse())
+		Expect(rc.requeueWait).To(BeNumerically("~", 30*time.Second, time.Second))
+	})
+})
+
+func deletingPod(pod *corev1.Pod) *corev1.Pod {
+	pod.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	return pod
+}
@@ -0,0 +1,106 @@
+package reconsilation
+
+import (
+	"math"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+)
+
+// stepReplicas returns the replicas the current scale down step goes down to, at most
+// spec.scaling.maxStepDown below current. Deletions go straight to 0
+func (rc *ReconciliationContext) stepReplicas(current int32) int32 {
+	desired := rc.desiredMemcachedReplicas()
+	maxStepDown := rc.Memcached.Spec.Scaling.MaxStepDown
+	if current <= desired || maxStepDown == nil || rc.Memcached.GetDeletionTimestamp() != nil {
+		return desired
+	}
+
+	step, err := intstr.GetScaledValueFromIntOrPercent(maxStepDown, int(current), true)
+	if err != nil || step < 1 {
+		return desired
+	}
+	if current-int32(step) < desired {
+		return desired
+	}
+	return current - int32(step)
+}
+
+// stepWait returns how long the next scale down step has to wait for the stabilization window
+// and the step interval, status.scaling has to be recorded first
+func (rc *ReconciliationContext) stepWait() time.Duration {
+	status := rc.Memcached.Status.Scaling
+	if status == nil || rc.Memcached.GetDeletionTimestamp() != nil {
+		return 0
+	}
+
+	var wait time.Duration
+	if window := rc.Memcached.Spec.Scaling.StabilizationWindow; window != nil {
+		wait = time.Until(status.Since.Add(window.Duration))
+	}
+	if status.LastStepTime != nil {
+		if left := time.Until(status.LastStepTime.Add(rc.Memcached.Spec.StepInterval())); left > wait {
+			wait = left
+		}
+	}
+
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// requeueAfter requeues once the duration is over
+func requeueAfter(d time.Duration) ReconcileResult {
+	return RequeueSoon(int(math.Ceil(d.Seconds())))
+}
+
+// requeueWithin makes the reconcile come back after d at the latest, without stopping the steps
+// that follow, see ProcessReconcile
+func (rc *ReconciliationContext) requeueWithin(d time.Duration) {
+	if d > 0 && (rc.requeueWait == 0 || d < rc.requeueWait) {
+		rc.requeueWait = d
+	}
+}
+
+// updateScalingStatus records the progress of a scale down in status.scaling, and clears it once
+// the workload is down to the desired replicas. stepped tells a step was just applied
+func (rc *ReconciliationContext) updateScalingStatus(current, step int32, stepped bool) error {
+	desired := rc.desiredMemcachedReplicas()
+
+	var scaling *cachev1.ScalingStatus
+	if current > desired {
+		scaling = &cachev1.ScalingStatus{
+			TargetReplicas: desired,
+			StepReplicas:   step,
+			Since:          metav1.Now(),
+		}
+		if previous := rc.Memcached.Status.Scaling; previous != nil {
+			scaling.Since = previous.Since
+			scaling.LastStepTime = previous.LastStepTime
+		}
+		if stepped {
+			now := metav1.Now()
+			scaling.LastStepTime = &now
+		}
+	}
+
+	if equality.Semantic.DeepEqual(scaling, rc.Memcached.Status.Scaling) {
+		return nil
+	}
+
+	patch := client.MergeFrom(rc.Memcached.DeepCopy())
+	rc.Memcached.Status.Scaling = scaling
+	if err := rc.Client.Status().Patch(rc.Ctx, rc.Memcached, patch); err != nil {
+		rc.ReqLogger.Error(err, "error updating the Memcached scaling status")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package reconsilation
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+)
+
+// deleting marks the Memcached as being deleted, the fake client only keeps it with a finalizer
+func deleting(m *cachev1.Memcached) *cachev1.Memcached {
+	m.Finalizers = []string{"test"}
+	m.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	return m
+}
+
+func ago(d time.Duration) metav1.Time {
+	return metav1.NewTime(time.Now().Add(-d))
+}
+
+var _ = Describe("Scaling", func() {
+	DescribeTable("Should step the scale down by maxStepDown",
+		func(size int32, maxStepDown *intstr.IntOrString, current int32, isDeleting bool, expected int32) {
+			m := &cachev1.Memcached{Spec: cachev1.MemcachedSpec{
+				Size:    size,
+				Scaling: cachev1.Scaling{MaxStepDown: maxStepDown},
+			}}
+			if isDeleting {
+				deleting(m)
+			}
+			rc := newTestContext(m)
+
+			Expect(rc.stepReplicas(current)).To(Equal(expected))
+		},
+		Entry("no maxStepDown", int32(2), nil, int32(10), false, int32(2)),
+		Entry("scale up", int32(10), ptrIntOrString(intstr.FromInt32(1)), int32(4), false, int32(10)),
+		Entry("integer", int32(2), ptrIntOrString(intstr.FromInt32(3)), int32(10), false, int32(7)),
+		Entry("percentage rounded up", int32(2), ptrIntOrString(intstr.FromString("25%")), int32(10), false, int32(7)),
+		Entry("small percentage removes a pod", int32(2), ptrIntOrString(intstr.FromString("1%")), int32(10), false, int32(9)),
+		Entry("last step clamped to the size", int32(6), ptrIntOrString(intstr.FromInt32(3)), int32(8), false, int32(6)),
+		Entry("deletion goes straight to 0", int32(2), ptrIntOrString(intstr.FromInt32(1)), int32(10), true, int32(0)),
+	)
+
+	DescribeTable("Should wait for the stabilization window and the step interval",
+		func(scaling cachev1.Scaling, status *cachev1.ScalingStatus, isDeleting bool, expected time.Duration) {
+			m := &cachev1.Memcached{Spec: cachev1.MemcachedSpec{Size: 2, Scaling: scaling}}
+			m.Status.Scaling = status
+			if isDeleting {
+				deleting(m)
+			}
+			rc := newTestContext(m)
+
+			Expect(rc.stepWait()).To(BeNumerically("~", expected, time.Second))
+		},
+		Entry("no scale down", cachev1.Scaling{}, nil, false, time.Duration(0)),
+		Entry("stabilization window pending",
+			cachev1.Scaling{StabilizationWindow: &metav1.Duration{Duration: 5 * time.Minute}},
+			&cachev1.ScalingStatus{Since: ago(time.Minute)}, false, 4*time.Minute),
+		Entry("window over, step interval pending",
+			cachev1.Scaling{StabilizationWindow: &metav1.Duration{Duration: time.Minute}},
+			&cachev1.ScalingStatus{Since: ago(5 * time.Minute), LastStepTime: ptrTime(ago(5 * time.Second))},
+			false, cachev1.DefaultStepInterval-5*time.Second),
+		Entry("step interval longer than what is left of the window",
+			cachev1.Scaling{
+				StabilizationWindow: &metav1.Duration{Duration: time.Minute},
+				StepInterval:        &metav1.Duration{Duration: 30 * time.Second},
+			},
+			&cachev1.ScalingStatus{Since: ago(50 * time.Second), LastStepTime: ptrTime(ago(0))},
+			false, 30*time.Second),
+		Entry("both over",
+			cachev1.Scaling{StabilizationWindow: &metav1.Duration{Duration: time.Minute}},
+			&cachev1.ScalingStatus{Since: ago(5 * time.Minute), LastStepTime: ptrTime(ago(time.Minute))},
+			false, time.Duration(0)),
+		Entry("deletion doesn't wait",
+			cachev1.Scaling{StabilizationWindow: &metav1.Duration{Duration: 5 * time.Minute}},
+			&cachev1.ScalingStatus{Since: ago(time.Minute), LastStepTime: ptrTime(ago(0))},
+			true, time.Duration(0)),
+	)
+
+	Context("Status", func() {
+		var (
+			m  *cachev1.Memcached
+			rc *ReconciliationContext
+		)
+
+		BeforeEach(func() {
+			m = &cachev1.Memcached{Spec: cachev1.MemcachedSpec{Size: 2}}
+			rc = newTestContext(m)
+		})
+
+		stored := func() *cachev1.Memcached {
+			actual := &cachev1.Memcached{}
+			Expect(rc.Client.Get(rc.Ctx, client.ObjectKeyFromObject(m), actual)).To(Succeed())
+			return actual
+		}
+
+		It("Should record a scale down before the first step", func() {
+			Expect(rc.updateScalingStatus(10, 7, false)).To(Succeed())
+
+			scaling := stored().Status.Scaling
+			Expect(scaling).NotTo(BeNil())
+			Expect(scaling.TargetReplicas).To(Equal(int32(2)))
+			Expect(scaling.StepReplicas).To(Equal(int32(7)))
+			Expect(scaling.Since.IsZero()).To(BeFalse())
+			Expect(scaling.LastStepTime).To(BeNil())
+		})
+
+		It("Should keep the start and record the step time", func() {
+			since := ago(time.Hour)
+			m = &cachev1.Memcached{Spec: cachev1.MemcachedSpec{Size: 2}}
+			m.Status.Scaling = &cachev1.ScalingStatus{TargetReplicas: 2, StepReplicas: 7, Since: since}
+			rc = newTestContext(m)
+
+			Expect(rc.updateScalingStatus(7, 7, true)).To(Succeed())
+
+			scaling := stored().Status.Scaling
+			Expect(scaling).NotTo(BeNil())
+			Expect(scaling.Since.Unix()).To(Equal(since.Unix()))
+			Expect(scaling.LastStepTime).NotTo(BeNil())
+			Expect(scaling.LastStepTime.Time).To(BeTemporally("~", time.Now(), time.Second))
+		})
+
+		It("Should clear the status once the size is reached", func() {
+			Expect(rc.updateScalingStatus(10, 7, false)).To(Succeed())
+			Expect(rc.updateScalingStatus(2, 2, true)).To(Succeed())
+
+			Expect(stored().Status.Scaling).To(BeNil())
+		})
+
+		It("Should not patch an unchanged status", func() {
+			Expect(rc.updateScalingStatus(10, 7, false)).To(Succeed())
+			version := stored().ResourceVersion
+
+			Expect(rc.updateScalingStatus(10, 7, false)).To(Succeed())
+
+			Expect(stored().ResourceVersion).To(Equal(version))
+		})
+	})
+})
+
+func ptrIntOrString(v intstr.IntOrString) *intstr.IntOrString {
+	return &v
+}
+
+func ptrTime(t metav1.Time) *metav1.Time {
+	return &t
+}
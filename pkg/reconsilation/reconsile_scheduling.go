@@ -0,0 +1,82 @@
+package reconsilation
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+)
+
+// addDefaultScheduling spreads the pods matching selector across zones and prefers distinct nodes,
+// a cache losing a whole zone or node at once sends all of its misses to the backend
+func addDefaultScheduling(spec *corev1.PodSpec, selector map[string]string) {
+	labelSelector := &metav1.LabelSelector{
+		MatchLabels: selector,
+	}
+
+	if spec.Affinity == nil {
+		spec.Affinity = &corev1.Affinity{}
+	}
+	spec.Affinity.PodAntiAffinity = &corev1.PodAntiAffinity{
+		PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{
+			Weight: 100,
+			PodAffinityTerm: corev1.PodAffinityTerm{
+				LabelSelector: labelSelector,
+				TopologyKey:   corev1.LabelHostname,
+			},
+		}},
+	}
+
+	spec.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{{
+		MaxSkew:           1,
+		TopologyKey:       corev1.LabelTopologyZone,
+		WhenUnsatisfiable: corev1.ScheduleAnyway,
+		LabelSelector:     labelSelector,
+	}}
+}
+
+// applyPodTemplate merges the user pod settings into the generated template, the labels and
+// annotations set by the operator win
+func applyPodTemplate(template *corev1.PodTemplateSpec, overrides cachev1.PodTemplate) {
+	if len(overrides.Labels) != 0 {
+		template.Labels = mergeStringMaps(overrides.Labels, template.Labels)
+	}
+	if len(overrides.Annotations) != 0 {
+		template.Annotations = mergeStringMaps(overrides.Annotations, template.Annotations)
+	}
+
+	spec := &template.Spec
+	if overrides.NodeSelector != nil {
+		spec.NodeSelector = overrides.NodeSelector
+	}
+	if overrides.Tolerations != nil {
+		spec.Tolerations = overrides.Tolerations
+	}
+	if overrides.TopologySpreadConstraints != nil {
+		spec.TopologySpreadConstraints = overrides.TopologySpreadConstraints
+	}
+	if overrides.PriorityClassName != "" {
+		spec.PriorityClassName = overrides.PriorityClassName
+	}
+	if overrides.ServiceAccountName != "" {
+		spec.ServiceAccountName = overrides.ServiceAccountName
+	}
+	if overrides.ImagePullSecrets != nil {
+		spec.ImagePullSecrets = overrides.ImagePullSecrets
+	}
+
+	if affinity := overrides.Affinity; affinity != nil {
+		if spec.Affinity == nil {
+			spec.Affinity = &corev1.Affinity{}
+		}
+		if affinity.NodeAffinity != nil {
+			spec.Affinity.NodeAffinity = affinity.NodeAffinity
+		}
+		if affinity.PodAffinity != nil {
+			spec.Affinity.PodAffinity = affinity.PodAffinity
+		}
+		if affinity.PodAntiAffinity != nil {
+			spec.Affinity.PodAntiAffinity = affinity.PodAntiAffinity
+		}
+	}
+}
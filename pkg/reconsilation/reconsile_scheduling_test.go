@@ -0,0 +1,117 @@
+package reconsilation
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+)
+
+// defaultTemplate is a pod template as generated, before the user settings are merged in
+func defaultTemplate() *corev1.PodTemplateSpec {
+	template := &corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:      map[string]string{"app.kubernetes.io/instance": "cache"},
+			Annotations: map[string]string{"cache.bsod.io/config-hash": "abc"},
+		},
+	}
+	addDefaultScheduling(&template.Spec, selectorLabelsForMemcached("cache"))
+	return template
+}
+
+var _ = Describe("Pod template", func() {
+	It("Should keep the defaults without overrides", func() {
+		template := defaultTemplate()
+		applyPodTemplate(template, cachev1.PodTemplate{})
+
+		Expect(template).To(Equal(defaultTemplate()))
+	})
+
+	It("Should let the operator labels and annotations win", func() {
+		template := defaultTemplate()
+		applyPodTemplate(template, cachev1.PodTemplate{
+			Labels: map[string]string{
+				"app.kubernetes.io/instance": "other",
+				"team":                       "cache",
+			},
+			Annotations: map[string]string{
+				"cache.bsod.io/config-hash": "other",
+				"owner":                     "team-cache",
+			},
+		})
+
+		Expect(template.Labels).To(Equal(map[string]string{
+			"app.kubernetes.io/instance": "cache",
+			"team":                       "cache",
+		}))
+		Expect(template.Annotations).To(Equal(map[string]string{
+			"cache.bsod.io/config-hash": "abc",
+			"owner":                     "team-cache",
+		}))
+	})
+
+	It("Should replace the zone spread and set the pod fields", func() {
+		spread := []corev1.TopologySpreadConstraint{{
+			MaxSkew:           2,
+			TopologyKey:       corev1.LabelHostname,
+			WhenUnsatisfiable: corev1.DoNotSchedule,
+		}}
+		tolerations := []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}}
+
+		template := defaultTemplate()
+		applyPodTemplate(template, cachev1.PodTemplate{
+			NodeSelector:              map[string]string{"pool": "cache"},
+			Tolerations:               tolerations,
+			TopologySpreadConstraints: spread,
+			PriorityClassName:         "high",
+			ServiceAccountName:        "cache",
+		})
+
+		Expect(template.Spec.NodeSelector).To(Equal(map[string]string{"pool": "cache"}))
+		Expect(template.Spec.Tolerations).To(Equal(tolerations))
+		Expect(template.Spec.TopologySpreadConstraints).To(Equal(spread))
+		Expect(template.Spec.PriorityClassName).To(Equal("high"))
+		Expect(template.Spec.ServiceAccountName).To(Equal("cache"))
+		Expect(template.Spec.Affinity).To(Equal(defaultTemplate().Spec.Affinity))
+	})
+
+	It("Should only replace the parts of the affinity that are set", func() {
+		nodeAffinity := &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+					MatchExpressions: []corev1.NodeSelectorRequirement{{
+						Key:      "pool",
+						Operator: corev1.NodeSelectorOpIn,
+						Values:   []string{"cache"},
+					}},
+				}},
+			},
+		}
+
+		template := defaultTemplate()
+		applyPodTemplate(template, cachev1.PodTemplate{
+			Affinity: &corev1.Affinity{NodeAffinity: nodeAffinity},
+		})
+
+		Expect(template.Spec.Affinity.NodeAffinity).To(Equal(nodeAffinity))
+		Expect(template.Spec.Affinity.PodAntiAffinity).To(Equal(defaultTemplate().Spec.Affinity.PodAntiAffinity))
+
+		By("replacing the default anti-affinity")
+		antiAffinity := &corev1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{{
+				LabelSelector: &metav1.LabelSelector{MatchLabels: selectorLabelsForMemcached("cache")},
+				TopologyKey:   corev1.LabelHostname,
+			}},
+		}
+		template = defaultTemplate()
+		applyPodTemplate(template, cachev1.PodTemplate{
+			Affinity: &corev1.Affinity{PodAntiAffinity: antiAffinity},
+		})
+
+		Expect(template.Spec.Affinity.PodAntiAffinity).To(Equal(antiAffinity))
+		Expect(template.Spec.TopologySpreadConstraints).To(Equal(defaultTemplate().Spec.TopologySpreadConstraints))
+	})
+})
@@ -0,0 +1,169 @@
+package reconsilation
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+	"github.com/0x0BSoD/memcached-operator/pkg/events"
+)
+
+const udpPortName = "memcached-udp"
+
+// applyServiceSpec sets the exposure settings of spec.service on a Service
+func applyServiceSpec(svc *corev1.Service, service cachev1.ServiceSpec) {
+	if service.Type != "" {
+		svc.Spec.Type = service.Type
+	}
+	if len(service.Annotations) != 0 {
+		svc.Annotations = mergeStringMaps(svc.Annotations, service.Annotations)
+	}
+
+	svc.Spec.LoadBalancerSourceRanges = service.LoadBalancerSourceRanges
+	svc.Spec.ExternalTrafficPolicy = service.ExternalTrafficPolicy
+	svc.Spec.InternalTrafficPolicy = service.InternalTrafficPolicy
+	svc.Spec.IPFamilies = service.IPFamilies
+	svc.Spec.IPFamilyPolicy = service.IPFamilyPolicy
+}
+
+// memcachedServicePorts returns the client ports of memcached, with the UDP twin of the
+// container port when spec.service.udp is set
+func (rc *ReconciliationContext) memcachedServicePorts() []corev1.ServicePort {
+	ports := []corev1.ServicePort{
+		{
+			Name: "memcached",
+			Port: rc.Memcached.Spec.ContainerPort,
+		},
+	}
+	if rc.Memcached.Spec.Service.UDP {
+		ports = append(ports, corev1.ServicePort{
+			Name:     udpPortName,
+			Port:     rc.Memcached.Spec.ContainerPort,
+			Protocol: corev1.ProtocolUDP,
+		})
+	}
+	return ports
+}
+
+// addMemcachedUDP enables the UDP listener on the container port
+func (rc *ReconciliationContext) addMemcachedUDP(template *corev1.PodTemplateSpec) {
+	if !rc.Memcached.Spec.Service.UDP {
+		return
+	}
+
+	container := &template.Spec.Containers[0]
+	container.Ports = append(container.Ports, corev1.ContainerPort{
+		ContainerPort: rc.Memcached.Spec.ContainerPort,
+		Name:          udpPortName,
+		Protocol:      corev1.ProtocolUDP,
+	})
+	container.Command = append(container.Command, fmt.Sprintf("--udp-port=%d", rc.Memcached.Spec.ContainerPort))
+}
+
+func headlessServiceNameForProxy(name string) string {
+	return fmt.Sprintf("%s-proxy-headless", name)
+}
+
+func (rc *ReconciliationContext) headlessServiceForProxy() (*corev1.Service, error) {
+	rc.ReqLogger.Info("[reconcile_service] headlessServiceForProxy")
+
+	image := imageForProxy(rc.Memcached.Spec.Proxy.Image)
+	ls := labelsForProxy(rc.Memcached.Name, image)
+
+	listenPort := proxyListenPort(proxyConfigWithDefaults(rc.Memcached.Spec.Proxy.Config).Listen)
+
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      headlessServiceNameForProxy(rc.Memcached.Name),
+			Namespace: rc.Memcached.Namespace,
+			Labels:    ls,
+		},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{
+					Name: "proxy",
+					Port: listenPort,
+				},
+			},
+			Selector:  selectorLabelsForProxy(rc.Memcached.Name),
+			ClusterIP: corev1.ClusterIPNone,
+			Type:      corev1.ServiceTypeClusterIP,
+		},
+	}
+
+	if err := ctrl.SetControllerReference(rc.Memcached, svc, rc.Scheme); err != nil {
+		return nil, err
+	}
+
+	return svc, nil
+}
+
+// CheckProxyHeadlessService keeps the headless twin of the proxy Service in line with
+// spec.proxy.service.headless
+func (rc *ReconciliationContext) CheckProxyHeadlessService() ReconcileResult {
+	if rc.proxyDeployment == nil || !rc.Memcached.Spec.Proxy.Enable {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_service] CheckProxyHeadlessService")
+
+	name := headlessServiceNameForProxy(rc.Memcached.Name)
+
+	if !rc.Memcached.Spec.Proxy.Service.Headless {
+		deleted, err := rc.deleteOwnedObject(&corev1.Service{}, name)
+		if err != nil {
+			return Error(err)
+		}
+		if deleted {
+			if err := setOperatorProgressStatus(rc, cachev1.ProgressUpdating); err != nil {
+				return Error(err)
+			}
+			rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.DeletedResource,
+				"Deleted Service %s", name)
+		}
+		return Continue()
+	}
+
+	desiredService, err := rc.headlessServiceForProxy()
+	if err != nil {
+		return Error(err)
+	}
+
+	currentService := &corev1.Service{}
+	err = rc.Client.Get(rc.Ctx,
+		types.NamespacedName{
+			Name:      name,
+			Namespace: rc.Memcached.Namespace,
+		}, currentService)
+	if errors.IsNotFound(err) {
+		rc.ReqLogger.Info(
+			"Creating a new headless Service for",
+			"Memcached-Proxy", rc.Memcached.Name)
+
+		if err := setOperatorProgressStatus(rc, cachev1.ProgressUpdating); err != nil {
+			return Error(err)
+		}
+
+		if err := rc.Client.Create(rc.Ctx, desiredService); err != nil {
+			return Error(err)
+		}
+
+		rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.CreatedResource,
+			"Created Service %s", desiredService.Name)
+		return Continue()
+	} else if err != nil {
+		rc.ReqLogger.Error(
+			err,
+			"Could not locate headless Service for",
+			"Memcached-Proxy", rc.Memcached.Name)
+		return Error(err)
+	}
+
+	return rc.updateServiceIfDrifted(currentService, desiredService)
+}
@@ -0,0 +1,269 @@
+package reconsilation
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+	"github.com/0x0BSoD/memcached-operator/pkg/events"
+)
+
+func headlessServiceNameForMemcached(name string) string {
+	return fmt.Sprintf("%s-headless", name)
+}
+
+// memcachedPodHost returns the stable DNS name of a StatefulSet pod, <pod>.<headless service>.<namespace>.svc
+func (rc *ReconciliationContext) memcachedPodHost(podName string) string {
+	return fmt.Sprintf("%s.%s.%s.svc",
+		podName,
+		headlessServiceNameForMemcached(rc.Memcached.Name),
+		rc.Memcached.Namespace,
+	)
+}
+
+func (rc *ReconciliationContext) headlessServiceForMemcached() (*corev1.Service, error) {
+	rc.ReqLogger.Info("[reconcile_statefulset] headlessServiceForMemcached")
+
+	image := imageForMemcached(rc.Memcached.Spec.Image)
+	ls := labelsForMemcached(rc.Memcached.Name, image)
+
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      headlessServiceNameForMemcached(rc.Memcached.Name),
+			Namespace: rc.Memcached.Namespace,
+			Labels:    ls,
+		},
+		Spec: corev1.ServiceSpec{
+			Ports:     rc.memcachedServicePorts(),
+			Selector:  selectorLabelsForMemcached(rc.Memcached.Name),
+			ClusterIP: corev1.ClusterIPNone,
+			Type:      corev1.ServiceTypeClusterIP,
+			// Pods have to resolve before they are ready, the proxy resolves its servers on startup
+			PublishNotReadyAddresses: rc.Memcached.Spec.Topology == cachev1.TopologyStatefulSet,
+		},
+	}
+
+	if err := ctrl.SetControllerReference(rc.Memcached, svc, rc.Scheme); err != nil {
+		return nil, err
+	}
+
+	return svc, nil
+}
+
+func (rc *ReconciliationContext) statefulSetForMemcached() (*appsv1.StatefulSet, error) {
+	rc.ReqLogger.Info("[reconcile_statefulset] statefulSetForMemcached")
+
+	image := imageForMemcached(rc.Memcached.Spec.Image)
+	ls := labelsForMemcached(rc.Memcached.Name, image)
+	replicas := rc.Memcached.Spec.Size
+
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      rc.Memcached.Name,
+			Namespace: rc.Memcached.Namespace,
+			Labels:    ls,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    &replicas,
+			ServiceName: headlessServiceNameForMemcached(rc.Memcached.Name),
+			// Memcached nodes don't depend on each other, no need to start them one by one
+			PodManagementPolicy: appsv1.ParallelPodManagement,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: selectorLabelsForMemcached(rc.Memcached.Name),
+			},
+			Template: rc.podTemplateForMemcached(),
+		},
+	}
+
+	if err := ctrl.SetControllerReference(rc.Memcached, sts, rc.Scheme); err != nil {
+		return nil, err
+	}
+
+	return sts, nil
+}
+
+func (rc *ReconciliationContext) CheckMemcachedStatefulSetCreation() ReconcileResult {
+	if rc.Memcached.Spec.Topology != cachev1.TopologyStatefulSet {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_statefulset] CheckMemcachedStatefulSetCreation")
+
+	currentStatefulSet := &appsv1.StatefulSet{}
+	err := rc.Client.Get(rc.Ctx,
+		types.NamespacedName{
+			Name:      rc.Memcached.Name,
+			Namespace: rc.Memcached.Namespace,
+		}, currentStatefulSet)
+
+	if errors.IsNotFound(err) {
+		rc.ReqLogger.Info(
+			"Creating a new StatefulSet for",
+			"Memcached", rc.Memcached.Name)
+
+		if err := setOperatorProgressStatus(rc, cachev1.ProgressUpdating); err != nil {
+			return Error(err)
+		}
+
+		sts, err := rc.statefulSetForMemcached()
+		if err != nil {
+			return Error(err)
+		}
+
+		if err := rc.Client.Create(rc.Ctx, sts); err != nil {
+			return Error(err)
+		}
+
+		rc.memcachedStatefulSet = sts
+
+		rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.CreatedResource,
+			"Created StatefulSet %s", sts.Name)
+		return Continue()
+	} else if err != nil {
+		rc.ReqLogger.Error(
+			err,
+			"Could not locate StatefulSet for",
+			"Memcached", rc.Memcached.Name)
+		return Error(err)
+	}
+
+	rc.memcachedStatefulSet = currentStatefulSet
+
+	return Continue()
+}
+
+// CheckMemcachedStatefulSetDrift brings the StatefulSet back in line with the Memcached spec,
+// replicas are left to CheckMemcachedDeploymentScaling
+func (rc *ReconciliationContext) CheckMemcachedStatefulSetDrift() ReconcileResult {
+	if rc.memcachedStatefulSet == nil {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_statefulset] CheckMemcachedStatefulSetDrift")
+
+	desiredStatefulSet, err := rc.statefulSetForMemcached()
+	if err != nil {
+		return Error(err)
+	}
+
+	return rc.updateStatefulSetIfDrifted(rc.memcachedStatefulSet, desiredStatefulSet)
+}
+
+// CheckMemcachedHeadlessServiceCreation creates the headless Service, the StatefulSet needs it for
+// the pod DNS names and the Deployment gets it with spec.service.headless
+func (rc *ReconciliationContext) CheckMemcachedHeadlessServiceCreation() ReconcileResult {
+	if workload, _ := rc.memcachedWorkload(); workload == nil {
+		return Continue()
+	}
+	if rc.memcachedStatefulSet == nil && !rc.Memcached.Spec.Service.Headless {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_statefulset] CheckMemcachedHeadlessServiceCreation")
+
+	currentService := &corev1.Service{}
+	err := rc.Client.Get(rc.Ctx,
+		types.NamespacedName{
+			Name:      headlessServiceNameForMemcached(rc.Memcached.Name),
+			Namespace: rc.Memcached.Namespace,
+		}, currentService)
+	if errors.IsNotFound(err) {
+		rc.ReqLogger.Info(
+			"Creating a new headless Service for",
+			"Memcached", rc.Memcached.Name)
+
+		if err := setOperatorProgressStatus(rc, cachev1.ProgressUpdating); err != nil {
+			return Error(err)
+		}
+
+		svc, err := rc.headlessServiceForMemcached()
+		if err != nil {
+			return Error(err)
+		}
+
+		if err := rc.Client.Create(rc.Ctx, svc); err != nil {
+			return Error(err)
+		}
+
+		rc.memcachedHeadlessService = svc
+
+		rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.CreatedResource,
+			"Created Service %s", svc.Name)
+		return Continue()
+	} else if err != nil {
+		rc.ReqLogger.Error(
+			err,
+			"Could not locate headless Service for",
+			"Memcached", rc.Memcached.Name)
+		return Error(err)
+	}
+
+	rc.memcachedHeadlessService = currentService
+
+	return Continue()
+}
+
+// CheckMemcachedHeadlessServiceDrift brings the headless Service back in line with the Memcached spec
+func (rc *ReconciliationContext) CheckMemcachedHeadlessServiceDrift() ReconcileResult {
+	if rc.memcachedHeadlessService == nil {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_statefulset] CheckMemcachedHeadlessServiceDrift")
+
+	desiredService, err := rc.headlessServiceForMemcached()
+	if err != nil {
+		return Error(err)
+	}
+
+	return rc.updateServiceIfDrifted(rc.memcachedHeadlessService, desiredService)
+}
+
+// CheckMemcachedTopologyCleanup removes the workload left over from the previous topology
+// once the topology has been switched
+func (rc *ReconciliationContext) CheckMemcachedTopologyCleanup() ReconcileResult {
+	rc.ReqLogger.Info("[reconcile_statefulset] CheckMemcachedTopologyCleanup")
+
+	owned := []ownedObject{
+		{"StatefulSet", rc.Memcached.Name, &appsv1.StatefulSet{}},
+	}
+	if !rc.Memcached.Spec.Service.Headless {
+		owned = append(owned, ownedObject{"Service", headlessServiceNameForMemcached(rc.Memcached.Name), &corev1.Service{}})
+	}
+	if rc.Memcached.Spec.Topology == cachev1.TopologyStatefulSet {
+		owned = []ownedObject{
+			{"Deployment", rc.Memcached.Name, &appsv1.Deployment{}},
+		}
+	}
+
+	for _, o := range owned {
+		deleted, err := rc.deleteOwnedObject(o.obj, o.name)
+		if err != nil {
+			rc.ReqLogger.Error(
+				err,
+				"Could not delete "+o.kind+" for",
+				"Memcached", rc.Memcached.Name)
+			return Error(err)
+		}
+		if !deleted {
+			continue
+		}
+
+		if err := setOperatorProgressStatus(rc, cachev1.ProgressUpdating); err != nil {
+			return Error(err)
+		}
+
+		rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.DeletedResource,
+			"Deleted %s %s, topology switched to %s", o.kind, o.name, rc.Memcached.Spec.Topology)
+	}
+
+	return Continue()
+}
@@ -0,0 +1,214 @@
+package reconsilation
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+)
+
+// memcachedStats are the counters of the stats command the status is built from
+type memcachedStats struct {
+	getHits     int64
+	getMisses   int64
+	evictions   int64
+	items       int64
+	bytes       int64
+	limitBytes  int64
+	connections int64
+	// pods are the names of the pods the counters are summed over
+	pods []string
+}
+
+func (s *memcachedStats) add(stats map[string]string) {
+	value := func(name string) int64 {
+		v, _ := strconv.ParseInt(stats[name], 10, 64)
+		return v
+	}
+
+	s.getHits += value("get_hits")
+	s.getMisses += value("get_misses")
+	s.evictions += value("evictions")
+	s.items += value("curr_items")
+	s.bytes += value("bytes")
+	s.limitBytes += value("limit_maxbytes")
+	s.connections += value("curr_connections")
+}
+
+// formatBytes prints a size with a binary suffix, e.g. 12.5Mi
+func formatBytes(b int64) string {
+	units := []string{"", "Ki", "Mi", "Gi", "Ti"}
+	value := float64(b)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return strconv.FormatFloat(math.Round(value*10)/10, 'f', -1, 64) + units[unit]
+}
+
+// statsPollWait returns how long until the stats are due, 0 when they are
+func (rc *ReconciliationContext) statsPollWait() time.Duration {
+	stats := rc.Memcached.Status.Stats
+	if stats == nil {
+		return 0
+	}
+	if wait := time.Until(stats.LastPollTime.Add(rc.Memcached.Spec.StatsInterval())); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// exceededThresholds returns the spec.stats.thresholds the polled stats cross, the rates are nil
+// until there is a previous poll to compare with
+func (rc *ReconciliationContext) exceededThresholds(
+	totals memcachedStats, hitRatio, evictionRate *float64,
+) []string {
+	thresholds := rc.Memcached.Spec.Stats.Thresholds
+
+	var exceeded []string
+	if ceiling := thresholds.MaxEvictionsPerSecond; ceiling != nil && evictionRate != nil &&
+		*evictionRate > ceiling.AsApproximateFloat64() {
+		exceeded = append(exceeded, fmt.Sprintf("%.2f evictions/s above %s", *evictionRate, ceiling.String()))
+	}
+	if floor := thresholds.MinHitRatio; floor != nil && hitRatio != nil && *hitRatio < float64(*floor) {
+		exceeded = append(exceeded, fmt.Sprintf("hit ratio %.1f%% below %d%%", *hitRatio, *floor))
+	}
+	if ceiling := thresholds.MaxMemoryUsage; ceiling != nil && totals.limitBytes > 0 &&
+		totals.bytes*100 > int64(*ceiling)*totals.limitBytes {
+		exceeded = append(exceeded, fmt.Sprintf("memory usage %s/%s above %d%%",
+			formatBytes(totals.bytes), formatBytes(totals.limitBytes), *ceiling))
+	}
+	if ceiling := thresholds.MaxConnections; ceiling != nil && totals.connections > int64(*ceiling) {
+		exceeded = append(exceeded, fmt.Sprintf("%d connections above %d", totals.connections, *ceiling))
+	}
+	return exceeded
+}
+
+// statsRates returns the hit ratio and eviction rate since the previous poll. When another set of
+// pods answered, or a counter went down because a pod restarted, the sums can't be compared and the
+// rates are skipped until the next poll, as is the hit ratio when no get came in
+func statsRates(previous *cachev1.StatsStatus, totals memcachedStats, now metav1.Time) (*float64, *float64) {
+	if previous == nil || !slices.Equal(totals.pods, previous.PolledPods) ||
+		totals.getHits < previous.GetHits || totals.getMisses < previous.GetMisses ||
+		totals.evictions < previous.Evictions {
+		return nil, nil
+	}
+	elapsed := now.Sub(previous.LastPollTime.Time).Seconds()
+	if elapsed <= 0 {
+		return nil, nil
+	}
+
+	var hitRatio *float64
+	hits := totals.getHits - previous.GetHits
+	if gets := hits + totals.getMisses - previous.GetMisses; gets > 0 {
+		ratio := float64(hits) * 100 / float64(gets)
+		hitRatio = &ratio
+	}
+	evictionRate := float64(totals.evictions-previous.Evictions) / elapsed
+
+	return hitRatio, &evictionRate
+}
+
+// memcachedPodStats polls a pod with the stats command
+func (rc *ReconciliationContext) memcachedPodStats(ctx context.Context, pod *corev1.Pod) (map[string]string, error) {
+	c, err := rc.dialMemcachedPod(ctx, pod)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	return c.Stats()
+}
+
+// CheckMemcachedStats polls the stats of the ready pods once spec.stats.interval is over, and sums
+// them up in status.stats. The thresholds crossed end up in the Degraded condition, see
+// CheckMemcachedConditions
+func (rc *ReconciliationContext) CheckMemcachedStats() ReconcileResult {
+	if !rc.Memcached.Spec.Stats.Enable || rc.textProtocolDisabled() {
+		if rc.Memcached.Status.Stats == nil {
+			return Continue()
+		}
+
+		patch := client.MergeFrom(rc.Memcached.DeepCopy())
+		rc.Memcached.Status.Stats = nil
+		if err := rc.Client.Status().Patch(rc.Ctx, rc.Memcached, patch); err != nil {
+			rc.ReqLogger.Error(err, "error clearing the Memcached stats")
+			return Error(err)
+		}
+		return Continue()
+	}
+
+	if rc.Memcached.GetDeletionTimestamp() != nil || rc.statsPollWait() > 0 {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_stats] CheckMemcachedStats")
+
+	var ready []*corev1.Pod
+	for _, pod := range rc.memcachedPods {
+		if pod.GetDeletionTimestamp() == nil && isPodReady(pod) && pod.Status.PodIP != "" {
+			ready = append(ready, pod)
+		}
+	}
+
+	now := metav1.Now()
+	var totals memcachedStats
+	var mu sync.Mutex
+	rc.pollMemcachedPods(ready, func(ctx context.Context, pod *corev1.Pod) {
+		stats, err := rc.memcachedPodStats(ctx, pod)
+		if err != nil {
+			rc.ReqLogger.Info("Could not poll the memcached stats", "Pod", pod.Name, "error", err.Error())
+			return
+		}
+		mu.Lock()
+		totals.add(stats)
+		totals.pods = append(totals.pods, pod.Name)
+		mu.Unlock()
+	})
+	sort.Strings(totals.pods)
+
+	status := &cachev1.StatsStatus{
+		Pods:         int32(len(totals.pods)),
+		PolledPods:   totals.pods,
+		GetHits:      totals.getHits,
+		GetMisses:    totals.getMisses,
+		Evictions:    totals.evictions,
+		Items:        totals.items,
+		Bytes:        totals.bytes,
+		LimitBytes:   totals.limitBytes,
+		Memory:       fmt.Sprintf("%s/%s", formatBytes(totals.bytes), formatBytes(totals.limitBytes)),
+		Connections:  int32(totals.connections),
+		LastPollTime: now,
+	}
+
+	hitRatio, evictionRate := statsRates(rc.Memcached.Status.Stats, totals, now)
+	if hitRatio != nil {
+		status.HitRatio = strconv.FormatFloat(*hitRatio, 'f', 1, 64) + "%"
+	}
+	if evictionRate != nil {
+		status.EvictionsPerSecond = strconv.FormatFloat(*evictionRate, 'f', 2, 64)
+	}
+
+	status.ThresholdsExceeded = rc.exceededThresholds(totals, hitRatio, evictionRate)
+
+	patch := client.MergeFrom(rc.Memcached.DeepCopy())
+	rc.Memcached.Status.Stats = status
+	if err := rc.Client.Status().Patch(rc.Ctx, rc.Memcached, patch); err != nil {
+		rc.ReqLogger.Error(err, "error updating the Memcached stats")
+		return Error(err)
+	}
+
+	return Continue()
+}
@@ -0,0 +1,157 @@
+package reconsilation
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+)
+
+func float(f float64) *float64 {
+	return &f
+}
+
+var _ = Describe("Stats", func() {
+	DescribeTable("Should print sizes with a binary suffix",
+		func(b int64, expected string) {
+			Expect(formatBytes(b)).To(Equal(expected))
+		},
+		Entry("bytes", int64(512), "512"),
+		Entry("kibibytes", int64(1536), "1.5Ki"),
+		Entry("mebibytes rounded", int64(12_600_000), "12Mi"),
+		Entry("gibibytes", int64(64*1024*1024*1024), "64Gi"),
+		Entry("past the largest unit", int64(2048)*1024*1024*1024*1024, "2048Ti"),
+	)
+
+	DescribeTable("Should wait for the stats interval",
+		func(stats *cachev1.StatsStatus, interval *metav1.Duration, due bool) {
+			m := &cachev1.Memcached{Spec: cachev1.MemcachedSpec{Stats: cachev1.Stats{Enable: true, Interval: interval}}}
+			m.Status.Stats = stats
+			rc := newTestContext(m)
+
+			if due {
+				Expect(rc.statsPollWait()).To(BeZero())
+			} else {
+				Expect(rc.statsPollWait()).To(BeNumerically(">", 0))
+			}
+		},
+		Entry("never polled", nil, nil, true),
+		Entry("polled recently", &cachev1.StatsStatus{
+			LastPollTime: metav1.NewTime(time.Now().Add(-10 * time.Second)),
+		}, nil, false),
+		Entry("default interval over", &cachev1.StatsStatus{
+			LastPollTime: metav1.NewTime(time.Now().Add(-time.Minute)),
+		}, nil, true),
+		Entry("custom interval over", &cachev1.StatsStatus{
+			LastPollTime: metav1.NewTime(time.Now().Add(-10 * time.Second)),
+		}, &metav1.Duration{Duration: 5 * time.Second}, true),
+	)
+
+	Context("Rates", func() {
+		now := metav1.NewTime(time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC))
+		pods := []string{"cache-a", "cache-b"}
+		previous := &cachev1.StatsStatus{
+			PolledPods:   pods,
+			GetHits:      1000,
+			GetMisses:    1000,
+			Evictions:    100,
+			LastPollTime: metav1.NewTime(now.Add(-time.Minute)),
+		}
+
+		DescribeTable("Should compute the rates from the increase since the previous poll",
+			func(previous *cachev1.StatsStatus, totals memcachedStats, hitRatio, evictionRate *float64) {
+				actualHitRatio, actualEvictionRate := statsRates(previous, totals, now)
+				Expect(actualHitRatio).To(Equal(hitRatio))
+				Expect(actualEvictionRate).To(Equal(evictionRate))
+			},
+			Entry("first poll", nil,
+				memcachedStats{getHits: 1000, getMisses: 1000, evictions: 100, pods: pods}, nil, nil),
+			Entry("since the previous poll, not since the pods started", previous,
+				memcachedStats{getHits: 1900, getMisses: 1100, evictions: 160, pods: pods}, float(90), float(1)),
+			Entry("no gets", previous,
+				memcachedStats{getHits: 1000, getMisses: 1000, evictions: 100, pods: pods}, nil, float(0)),
+			Entry("hits counter reset", previous,
+				memcachedStats{getHits: 10, getMisses: 1100, evictions: 160, pods: pods}, nil, nil),
+			Entry("evictions counter reset", previous,
+				memcachedStats{getHits: 1900, getMisses: 1100, evictions: 5, pods: pods}, nil, nil),
+			Entry("a pod missing from this poll", previous,
+				memcachedStats{getHits: 1500, getMisses: 1100, evictions: 120, pods: []string{"cache-a"}}, nil, nil),
+			Entry("a pod missing from the previous poll", previous,
+				memcachedStats{
+					getHits: 5000, getMisses: 3000, evictions: 900, pods: []string{"cache-a", "cache-b", "cache-c"},
+				}, nil, nil),
+		)
+	})
+
+	DescribeTable("Should report the thresholds crossed",
+		func(thresholds cachev1.StatsThresholds, totals memcachedStats, hitRatio, evictionRate *float64,
+			expected []string) {
+			rc := newTestContext(&cachev1.Memcached{Spec: cachev1.MemcachedSpec{
+				Stats: cachev1.Stats{Enable: true, Thresholds: thresholds},
+			}})
+
+			Expect(rc.exceededThresholds(totals, hitRatio, evictionRate)).To(Equal(expected))
+		},
+		Entry("no thresholds", cachev1.StatsThresholds{},
+			memcachedStats{bytes: 100, limitBytes: 100, connections: 1000}, float(10), float(100), nil),
+		Entry("eviction rate", cachev1.StatsThresholds{
+			MaxEvictionsPerSecond: &[]resource.Quantity{resource.MustParse("0.5")}[0],
+		}, memcachedStats{}, nil, float(1.25), []string{"1.25 evictions/s above 500m"}),
+		Entry("eviction rate unknown", cachev1.StatsThresholds{
+			MaxEvictionsPerSecond: &[]resource.Quantity{resource.MustParse("0.5")}[0],
+		}, memcachedStats{}, nil, nil, nil),
+		Entry("hit ratio", cachev1.StatsThresholds{MinHitRatio: &[]int32{80}[0]},
+			memcachedStats{}, float(75.25), nil, []string{"hit ratio 75.2% below 80%"}),
+		Entry("hit ratio unknown", cachev1.StatsThresholds{MinHitRatio: &[]int32{80}[0]},
+			memcachedStats{}, nil, nil, nil),
+		Entry("memory usage", cachev1.StatsThresholds{MaxMemoryUsage: &[]int32{90}[0]},
+			memcachedStats{bytes: 60 * 1024 * 1024, limitBytes: 64 * 1024 * 1024}, nil, nil,
+			[]string{"memory usage 60Mi/64Mi above 90%"}),
+		Entry("memory usage below", cachev1.StatsThresholds{MaxMemoryUsage: &[]int32{90}[0]},
+			memcachedStats{bytes: 32 * 1024 * 1024, limitBytes: 64 * 1024 * 1024}, nil, nil, nil),
+		Entry("connections", cachev1.StatsThresholds{MaxConnections: &[]int32{10}[0]},
+			memcachedStats{connections: 12}, nil, nil, []string{"12 connections above 10"}),
+	)
+
+	It("Should poll the pods concurrently within a bound", func() {
+		rc := newTestContext(&cachev1.Memcached{})
+
+		pods := make([]*corev1.Pod, 3*memcachedPollConcurrency)
+		for i := range pods {
+			pods[i] = &corev1.Pod{}
+		}
+
+		var mu sync.Mutex
+		running, peak, polled, bounded := 0, 0, 0, 0
+		rc.pollMemcachedPods(pods, func(ctx context.Context, _ *corev1.Pod) {
+			mu.Lock()
+			running++
+			polled++
+			if running > peak {
+				peak = running
+			}
+			mu.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			if _, found := ctx.Deadline(); found {
+				bounded++
+			}
+			mu.Unlock()
+		})
+
+		Expect(polled).To(Equal(len(pods)))
+		Expect(peak).To(Equal(memcachedPollConcurrency))
+		Expect(bounded).To(Equal(len(pods)))
+	})
+})
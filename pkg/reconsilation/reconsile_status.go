@@ -0,0 +1,235 @@
+package reconsilation
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+	"github.com/0x0BSoD/memcached-operator/pkg/memcached"
+)
+
+const (
+	// memcachedPollTimeout bounds a round of version or stats polls, well under the time a
+	// reconcile is expected to take
+	memcachedPollTimeout = 5 * time.Second
+	// memcachedPollConcurrency is how many pods are polled at once
+	memcachedPollConcurrency = 8
+)
+
+// connectionString returns the address clients connect to, the proxy Service when the proxy is
+// enabled and the memcached Service otherwise
+func (rc *ReconciliationContext) connectionString() string {
+	if rc.Memcached.Spec.Proxy.Enable {
+		listenPort := proxyListenPort(proxyConfigWithDefaults(rc.Memcached.Spec.Proxy.Config).Listen)
+		return fmt.Sprintf("%s-proxy.%s.svc:%d", rc.Memcached.Name, rc.Memcached.Namespace, listenPort)
+	}
+	return fmt.Sprintf("%s.%s.svc:%d", rc.Memcached.Name, rc.Memcached.Namespace, rc.Memcached.Spec.ContainerPort)
+}
+
+// resolvedImages returns the images of the containers the operator runs
+func (rc *ReconciliationContext) resolvedImages() cachev1.ImagesStatus {
+	spec := rc.Memcached.Spec
+
+	images := cachev1.ImagesStatus{
+		Memcached: imageForMemcached(spec.Image),
+	}
+	if spec.Proxy.Enable {
+		images.Proxy = imageForProxy(spec.Proxy.Image)
+	}
+	if spec.Monitoring.Enable {
+		images.Exporter = imageForExporter(spec.Monitoring.ExporterImage, "EXPORTER_IMAGE", cachev1.ExporterDefaultImage)
+		if spec.Proxy.Enable {
+			images.ProxyExporter = imageForExporter(spec.Monitoring.ProxyExporterImage,
+				"PROXY_EXPORTER_IMAGE", cachev1.ProxyExporterDefaultImage)
+		}
+	}
+	return images
+}
+
+// memcachedEndpoints lists the memcached pods with the version they report. A version is only
+// queried when a pod becomes ready or changes address, otherwise the one in status is kept
+func (rc *ReconciliationContext) memcachedEndpoints() []cachev1.EndpointStatus {
+	previous := make(map[string]cachev1.EndpointStatus, len(rc.Memcached.Status.Endpoints))
+	for _, endpoint := range rc.Memcached.Status.Endpoints {
+		previous[endpoint.Pod] = endpoint
+	}
+
+	port := strconv.Itoa(int(rc.Memcached.Spec.ContainerPort))
+	endpoints := make([]cachev1.EndpointStatus, 0, len(rc.memcachedPods))
+	var unknown []*corev1.Pod
+	for _, pod := range rc.memcachedPods {
+		if pod.GetDeletionTimestamp() != nil || pod.Status.PodIP == "" {
+			continue
+		}
+
+		host := pod.Status.PodIP
+		if rc.Memcached.Spec.Topology == cachev1.TopologyStatefulSet {
+			host = rc.memcachedPodHost(pod.Name)
+		}
+		endpoint := cachev1.EndpointStatus{
+			Pod:     pod.Name,
+			Address: net.JoinHostPort(host, port),
+			Ready:   isPodReady(pod),
+		}
+
+		if last, found := previous[pod.Name]; found && last.Ready && last.Address == endpoint.Address {
+			endpoint.Version = last.Version
+		}
+		if endpoint.Ready && endpoint.Version == "" && !rc.textProtocolDisabled() {
+			unknown = append(unknown, pod)
+		}
+
+		endpoints = append(endpoints, endpoint)
+	}
+
+	versions := make(map[string]string, len(unknown))
+	var mu sync.Mutex
+	rc.pollMemcachedPods(unknown, func(ctx context.Context, pod *corev1.Pod) {
+		version, err := rc.memcachedVersion(ctx, pod)
+		if err != nil {
+			rc.ReqLogger.Info("Could not query the memcached version", "Pod", pod.Name, "error", err.Error())
+			return
+		}
+		mu.Lock()
+		versions[pod.Name] = version
+		mu.Unlock()
+	})
+	for i := range endpoints {
+		if version, found := versions[endpoints[i].Pod]; found {
+			endpoints[i].Version = version
+		}
+	}
+
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].Pod < endpoints[j].Pod
+	})
+
+	return endpoints
+}
+
+// pollMemcachedPods runs poll against the pods concurrently, at most memcachedPollConcurrency at a
+// time and within memcachedPollTimeout overall, so a few unresponsive pods can't hold up the
+// reconcile. poll reports its own errors, one pod failing doesn't stop the others
+func (rc *ReconciliationContext) pollMemcachedPods(pods []*corev1.Pod, poll func(context.Context, *corev1.Pod)) {
+	if len(pods) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(rc.Ctx, memcachedPollTimeout)
+	defer cancel()
+
+	var group errgroup.Group
+	group.SetLimit(memcachedPollConcurrency)
+	for _, pod := range pods {
+		pod := pod
+		group.Go(func() error {
+			poll(ctx, pod)
+			return nil
+		})
+	}
+	_ = group.Wait()
+}
+
+// dialMemcachedPod connects to a pod by IP, logged in when auth is on
+func (rc *ReconciliationContext) dialMemcachedPod(ctx context.Context, pod *corev1.Pod) (*memcached.Client, error) {
+	tlsConfig, err := rc.memcachedClientTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	addr := net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(int(rc.Memcached.Spec.ContainerPort)))
+	c, err := memcached.Dial(ctx, addr, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rc.authenticateMemcached(c); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// memcachedVersion asks a pod for its version
+func (rc *ReconciliationContext) memcachedVersion(ctx context.Context, pod *corev1.Pod) (string, error) {
+	c, err := rc.dialMemcachedPod(ctx, pod)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+
+	return c.Version()
+}
+
+// CheckMemcachedScaleStatus keeps status.size and status.selector, read through the scale
+// subresource by kubectl scale and the HorizontalPodAutoscaler, up to date with the workload
+func (rc *ReconciliationContext) CheckMemcachedScaleStatus() ReconcileResult {
+	state, found := rc.memcachedWorkloadState()
+	if !found {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_status] CheckMemcachedScaleStatus")
+
+	selector := labels.SelectorFromSet(selectorLabelsForMemcached(rc.Memcached.Name)).String()
+	if rc.Memcached.Status.Size == state.current && rc.Memcached.Status.Selector == selector {
+		return Continue()
+	}
+
+	patch := client.MergeFrom(rc.Memcached.DeepCopy())
+	rc.Memcached.Status.Size = state.current
+	rc.Memcached.Status.Selector = selector
+	if err := rc.Client.Status().Patch(rc.Ctx, rc.Memcached, patch); err != nil {
+		rc.ReqLogger.Error(err, "error updating the Memcached scale status")
+		return Error(err)
+	}
+
+	return Continue()
+}
+
+// CheckMemcachedStatus reports the replicas, endpoints, connection string and images of the
+// memcached tier in status, the proxy replicas are set by CheckProxyDeploymentScaling
+func (rc *ReconciliationContext) CheckMemcachedStatus() ReconcileResult {
+	state, found := rc.memcachedWorkloadState()
+	if !found {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_status] CheckMemcachedStatus")
+
+	status := rc.Memcached.Status.DeepCopy()
+	status.Replicas = state.current
+	status.ReadyReplicas = state.ready
+	status.AvailableReplicas = state.available
+	status.Ready = fmt.Sprintf("%d/%d", state.ready, rc.desiredMemcachedReplicas())
+	status.Endpoints = rc.memcachedEndpoints()
+	status.ConnectionString = rc.connectionString()
+	status.Images = rc.resolvedImages()
+
+	if equality.Semantic.DeepEqual(*status, rc.Memcached.Status) {
+		return Continue()
+	}
+
+	patch := client.MergeFrom(rc.Memcached.DeepCopy())
+	rc.Memcached.Status = *status
+	if err := rc.Client.Status().Patch(rc.Ctx, rc.Memcached, patch); err != nil {
+		rc.ReqLogger.Error(err, "error updating the Memcached status")
+		return Error(err)
+	}
+
+	return Continue()
+}
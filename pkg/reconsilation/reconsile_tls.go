@@ -0,0 +1,388 @@
+package reconsilation
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+	"github.com/0x0BSoD/memcached-operator/pkg/events"
+	"github.com/0x0BSoD/memcached-operator/pkg/memcached"
+)
+
+const (
+	tlsVolumeName = "tls"
+	tlsMountPath  = "/etc/memcached/tls"
+)
+
+var certificateGVK = schema.GroupVersionKind{
+	Group:   "cert-manager.io",
+	Version: "v1",
+	Kind:    "Certificate",
+}
+
+func tlsSecretNameForMemcached(m *cachev1.Memcached) string {
+	if m.Spec.TLS.SecretName == "" {
+		return fmt.Sprintf("%s-tls", m.Name)
+	}
+	return m.Spec.TLS.SecretName
+}
+
+// tlsOptionsForMemcached builds the ssl_* entries of the -o option list
+func tlsOptionsForMemcached(tlsSpec cachev1.TLS) []string {
+	if !tlsSpec.Enable {
+		return nil
+	}
+
+	opts := []string{
+		fmt.Sprintf("ssl_chain_cert=%s/%s", tlsMountPath, corev1.TLSCertKey),
+		fmt.Sprintf("ssl_key=%s/%s", tlsMountPath, corev1.TLSPrivateKeyKey),
+	}
+	if tlsSpec.VerifyClients {
+		// 2 requires a client certificate
+		opts = append(opts,
+			fmt.Sprintf("ssl_ca_cert=%s/%s", tlsMountPath, corev1.ServiceAccountRootCAKey),
+			"ssl_verify_mode=2",
+		)
+	}
+
+	return opts
+}
+
+// textProtocolDisabled reports whether memcached refuses text protocol commands,
+// SASL and the binary protocol turn it off
+func (rc *ReconciliationContext) textProtocolDisabled() bool {
+	spec := rc.Memcached.Spec
+	return (spec.Auth.Enable && spec.Auth.Mode == cachev1.AuthModeSASL) ||
+		spec.Tuning.Protocol == cachev1.ProtocolBinary
+}
+
+// tlsReloadNeedsRestart reports whether refresh_certs can't be sent, it is a text protocol command
+func (rc *ReconciliationContext) tlsReloadNeedsRestart() bool {
+	return rc.textProtocolDisabled()
+}
+
+// addMemcachedTLS mounts the certificate into the memcached container of the template, the
+// kubelet keeps the files in sync with the Secret so they can be reloaded in place
+func (rc *ReconciliationContext) addMemcachedTLS(template *corev1.PodTemplateSpec) {
+	if !rc.Memcached.Spec.TLS.Enable {
+		return
+	}
+
+	template.Spec.SecurityContext.FSGroup = &[]int64{memcachedUID}[0]
+	template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+		Name: tlsVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName:  tlsSecretNameForMemcached(rc.Memcached),
+				DefaultMode: &[]int32{0440}[0],
+			},
+		},
+	})
+
+	container := &template.Spec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      tlsVolumeName,
+		MountPath: tlsMountPath,
+		ReadOnly:  true,
+	})
+}
+
+func (rc *ReconciliationContext) certificateForMemcached() (*unstructured.Unstructured, error) {
+	rc.ReqLogger.Info("[reconcile_tls] certificateForMemcached")
+
+	m := rc.Memcached
+	certManager := m.Spec.TLS.CertManager
+	image := imageForMemcached(m.Spec.Image)
+
+	dnsNames := []interface{}{
+		m.Name,
+		fmt.Sprintf("%s.%s", m.Name, m.Namespace),
+		fmt.Sprintf("%s.%s.svc", m.Name, m.Namespace),
+		fmt.Sprintf("*.%s.%s.svc", headlessServiceNameForMemcached(m.Name), m.Namespace),
+	}
+
+	spec := map[string]interface{}{
+		"secretName": tlsSecretNameForMemcached(m),
+		"dnsNames":   dnsNames,
+		"issuerRef": map[string]interface{}{
+			"name":  certManager.IssuerRef.Name,
+			"kind":  certManager.IssuerRef.Kind,
+			"group": certManager.IssuerRef.Group,
+		},
+		// the operator presents the certificate itself when it sends refresh_certs
+		"usages": []interface{}{"server auth", "client auth"},
+	}
+	if certManager.Duration != nil {
+		spec["duration"] = certManager.Duration.Duration.String()
+	}
+	if certManager.RenewBefore != nil {
+		spec["renewBefore"] = certManager.RenewBefore.Duration.String()
+	}
+
+	cert := &unstructured.Unstructured{}
+	cert.SetGroupVersionKind(certificateGVK)
+	cert.SetName(m.Name)
+	cert.SetNamespace(m.Namespace)
+	cert.SetLabels(labelsForMemcached(m.Name, image))
+	if err := unstructured.SetNestedMap(cert.Object, spec, "spec"); err != nil {
+		return nil, err
+	}
+
+	if err := ctrl.SetControllerReference(m, cert, rc.Scheme); err != nil {
+		return nil, err
+	}
+
+	return cert, nil
+}
+
+// CheckMemcachedCertificate keeps the cert-manager Certificate in line with spec.tls.certManager
+// and removes it once certManager is unset. The Certificate kind is only looked up while
+// certManager is set or a Certificate is left to clean up
+func (rc *ReconciliationContext) CheckMemcachedCertificate() ReconcileResult {
+	tlsSpec := rc.Memcached.Spec.TLS
+	enabled := tlsSpec.Enable && tlsSpec.CertManager != nil
+	if !enabled && !rc.optionalResourceCreated(certificateGVK.Kind) {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_tls] CheckMemcachedCertificate")
+
+	exists, err := rc.kindExists(certificateGVK)
+	if err != nil {
+		return Error(err)
+	}
+
+	if !enabled {
+		if exists {
+			if err := rc.deleteOwnedUnstructured(certificateGVK, rc.Memcached.Name); err != nil {
+				return Error(err)
+			}
+		}
+		if err := setOptionalResource(rc, certificateGVK.Kind, false); err != nil {
+			return Error(err)
+		}
+		return Continue()
+	}
+
+	if !exists {
+		return Error(fmt.Errorf("spec.tls.certManager is set but the cert-manager Certificate CRD is not installed"))
+	}
+
+	desired, err := rc.certificateForMemcached()
+	if err != nil {
+		return Error(err)
+	}
+
+	if err := rc.applyUnstructured(desired); err != nil {
+		return Error(err)
+	}
+
+	if err := setOptionalResource(rc, certificateGVK.Kind, true); err != nil {
+		return Error(err)
+	}
+
+	return Continue()
+}
+
+// CheckMemcachedTLSSecret loads the certificate Secret, the pods can't start without it
+func (rc *ReconciliationContext) CheckMemcachedTLSSecret() ReconcileResult {
+	tlsSpec := rc.Memcached.Spec.TLS
+	if !tlsSpec.Enable {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_tls] CheckMemcachedTLSSecret")
+
+	secret := &corev1.Secret{}
+	err := rc.Client.Get(rc.Ctx,
+		types.NamespacedName{
+			Name:      tlsSecretNameForMemcached(rc.Memcached),
+			Namespace: rc.Memcached.Namespace,
+		}, secret)
+	if errors.IsNotFound(err) && tlsSpec.CertManager != nil {
+		rc.ReqLogger.Info("Waiting for cert-manager to issue the certificate",
+			"Secret", tlsSecretNameForMemcached(rc.Memcached))
+		return RequeueSoon(10)
+	} else if err != nil {
+		rc.ReqLogger.Error(
+			err,
+			"Could not locate the TLS Secret for",
+			"Memcached", rc.Memcached.Name)
+		return Error(err)
+	}
+
+	keys := []string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey}
+	if tlsSpec.VerifyClients {
+		keys = append(keys, corev1.ServiceAccountRootCAKey)
+	}
+	for _, key := range keys {
+		if _, found := secret.Data[key]; !found {
+			return Error(fmt.Errorf("TLS Secret %s has no %s key", secret.Name, key))
+		}
+	}
+
+	rc.memcachedTLSSecret = secret
+
+	return Continue()
+}
+
+// CheckMemcachedTLSRefresh makes the running pods reload a rotated certificate with refresh_certs,
+// pods serving the current certificate are marked with its hash so they are only dialed once
+func (rc *ReconciliationContext) CheckMemcachedTLSRefresh() ReconcileResult {
+	if rc.memcachedTLSSecret == nil || rc.tlsReloadNeedsRestart() {
+		return Continue()
+	}
+
+	rc.ReqLogger.Info("[reconcile_tls] CheckMemcachedTLSRefresh")
+
+	secret := rc.memcachedTLSSecret
+	desiredHash := hashSecretData(secret)
+
+	leaf, _ := pem.Decode(secret.Data[corev1.TLSCertKey])
+	if leaf == nil {
+		return Error(fmt.Errorf("TLS Secret %s has no PEM certificate", secret.Name))
+	}
+
+	tlsConfig, err := rc.memcachedClientTLSConfig()
+	if err != nil {
+		return Error(err)
+	}
+
+	pending := false
+	for _, pod := range rc.memcachedPods {
+		if !isPodReady(pod) || pod.Annotations[cachev1.TLSSecretHashAnnotation] == desiredHash {
+			continue
+		}
+
+		refreshed, err := rc.refreshPodCerts(pod, tlsConfig, leaf.Bytes)
+		if err != nil {
+			rc.ReqLogger.Error(err, "Could not refresh the certificates", "Pod", pod.Name)
+			pending = true
+			continue
+		}
+		if !refreshed {
+			// the kubelet hasn't synced the Secret into the pod yet
+			pending = true
+			continue
+		}
+
+		patch := client.MergeFrom(pod.DeepCopy())
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[cachev1.TLSSecretHashAnnotation] = desiredHash
+		if err := rc.Client.Patch(rc.Ctx, pod, patch); err != nil {
+			return Error(err)
+		}
+	}
+
+	if pending {
+		return RequeueSoon(15)
+	}
+
+	return Continue()
+}
+
+// refreshPodCerts reports whether the pod serves the leaf certificate, sending refresh_certs first
+// when it doesn't
+func (rc *ReconciliationContext) refreshPodCerts(pod *corev1.Pod, tlsConfig *tls.Config, leaf []byte) (bool, error) {
+	addr := net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(int(rc.Memcached.Spec.ContainerPort)))
+
+	c, err := memcached.Dial(rc.Ctx, addr, tlsConfig)
+	if err != nil {
+		return false, err
+	}
+	defer c.Close()
+
+	if servesCertificate(c, leaf) {
+		return true, nil
+	}
+
+	if err := rc.authenticateMemcached(c); err != nil {
+		return false, err
+	}
+
+	if err := c.RefreshCerts(); err != nil {
+		return false, err
+	}
+
+	// refresh_certs only applies to new connections
+	check, err := memcached.Dial(rc.Ctx, addr, tlsConfig)
+	if err != nil {
+		return false, err
+	}
+	defer check.Close()
+
+	if !servesCertificate(check, leaf) {
+		return false, nil
+	}
+
+	rc.Recorder.Eventf(rc.Memcached, corev1.EventTypeNormal, events.RefreshedCerts,
+		"Reloaded the certificates of Pod %s", pod.Name)
+
+	return true, nil
+}
+
+// memcachedClientTLSConfig returns the TLS config the operator dials the pods with, it presents
+// the served certificate in case memcached verifies clients. nil when TLS is off
+func (rc *ReconciliationContext) memcachedClientTLSConfig() (*tls.Config, error) {
+	secret := rc.memcachedTLSSecret
+	if secret == nil {
+		return nil, nil
+	}
+
+	clientCert, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{clientCert},
+		MinVersion:   tls.VersionTLS12,
+		// The pods are dialed by IP and only the served certificate is compared, nothing is
+		// sent that needs a verified server
+		InsecureSkipVerify: true, //nolint:gosec
+	}, nil
+}
+
+// authenticateMemcached logs in with the first ASCII auth credentials when auth is on
+func (rc *ReconciliationContext) authenticateMemcached(c *memcached.Client) error {
+	auth := rc.Memcached.Spec.Auth
+	if !auth.Enable || rc.memcachedAuthSecret == nil {
+		return nil
+	}
+	username, password := firstAuthCredentials(rc.memcachedAuthSecret.Data[authSecretKey(auth)])
+	return c.Authenticate(username, password)
+}
+
+func servesCertificate(c *memcached.Client, leaf []byte) bool {
+	certs := c.PeerCertificates()
+	return len(certs) != 0 && bytes.Equal(certs[0].Raw, leaf)
+}
+
+// firstAuthCredentials returns the first username:password line of an auth file
+func firstAuthCredentials(data []byte) (string, string) {
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		username, password, _ := strings.Cut(line, ":")
+		return username, password
+	}
+	return "", ""
+}
@@ -0,0 +1,48 @@
+package reconsilation
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+)
+
+var _ = Describe("Certificate", func() {
+	It("Should not look the Certificate kind up while cert-manager is off", func() {
+		rc := newTestContext(&cachev1.Memcached{Spec: cachev1.MemcachedSpec{
+			TLS: cachev1.TLS{Enable: true, SecretName: "memcached-tls"},
+		}})
+		mapper := countRESTMappings(rc)
+
+		Expect(rc.CheckMemcachedCertificate().Completed()).To(BeFalse())
+		Expect(mapper.lookups).To(BeZero())
+	})
+
+	It("Should look the Certificate kind up once to clean up the one it created", func() {
+		rc := newTestContext(&cachev1.Memcached{Status: cachev1.MemcachedStatus{
+			OptionalResources: []string{"Certificate", "ServiceMonitor"},
+		}})
+		mapper := countRESTMappings(rc)
+
+		Expect(rc.CheckMemcachedCertificate().Completed()).To(BeFalse())
+		Expect(mapper.lookups).To(Equal(1))
+		Expect(rc.Memcached.Status.OptionalResources).To(Equal([]string{"ServiceMonitor"}))
+
+		Expect(rc.CheckMemcachedCertificate().Completed()).To(BeFalse())
+		Expect(mapper.lookups).To(Equal(1))
+	})
+
+	It("Should fail when cert-manager is set but not installed", func() {
+		rc := newTestContext(&cachev1.Memcached{Spec: cachev1.MemcachedSpec{
+			TLS: cachev1.TLS{Enable: true, CertManager: &cachev1.CertManager{
+				IssuerRef: cachev1.IssuerReference{Name: "issuer"},
+			}},
+		}})
+
+		result := rc.CheckMemcachedCertificate()
+		Expect(result.Completed()).To(BeTrue())
+		_, err := result.Output()
+		Expect(err).To(HaveOccurred())
+		Expect(rc.Memcached.Status.OptionalResources).To(BeEmpty())
+	})
+})
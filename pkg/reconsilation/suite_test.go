@@ -0,0 +1,87 @@
+package reconsilation
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/go-logr/logr"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	cachev1 "github.com/0x0BSoD/memcached-operator/api/v1"
+)
+
+// These tests use Ginkgo (BDD-style Go testing framework). Refer to
+// http://onsi.github.io/ginkgo/ to learn more about Ginkgo.
+
+func TestReconsilation(t *testing.T) {
+	RegisterFailHandler(Fail)
+
+	RunSpecs(t, "Reconsilation Suite")
+}
+
+// newTestContext returns a context around the Memcached backed by a fake client holding objs
+func newTestContext(m *cachev1.Memcached, objs ...client.Object) *ReconciliationContext {
+	scheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	Expect(cachev1.AddToScheme(scheme)).To(Succeed())
+
+	if m.Name == "" {
+		m.Name = "test-memcached"
+	}
+	if m.Namespace == "" {
+		m.Namespace = "default"
+	}
+
+	return &ReconciliationContext{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(append(objs, m)...).
+			WithStatusSubresource(m).
+			Build(),
+		Scheme:    scheme,
+		ReqLogger: logr.Discard(),
+		Recorder:  record.NewFakeRecorder(100),
+		Memcached: m,
+		Ctx:       context.Background(),
+	}
+}
+
+// countingRESTMapper counts the kind lookups, the manager RESTMapper runs discovery for a kind it
+// doesn't know
+type countingRESTMapper struct {
+	meta.RESTMapper
+	lookups int
+}
+
+func (m *countingRESTMapper) RESTMapping(gk schema.GroupKind, versions ...string) (*meta.RESTMapping, error) {
+	m.lookups++
+	return m.RESTMapper.RESTMapping(gk, versions...)
+}
+
+// mapperClient swaps the RESTMapper of a client
+type mapperClient struct {
+	client.Client
+	mapper meta.RESTMapper
+}
+
+func (c mapperClient) RESTMapper() meta.RESTMapper {
+	return c.mapper
+}
+
+// countRESTMappings makes the context count its kind lookups
+func countRESTMappings(rc *ReconciliationContext) *countingRESTMapper {
+	mapper := &countingRESTMapper{RESTMapper: rc.Client.RESTMapper()}
+	rc.Client = mapperClient{Client: rc.Client, mapper: mapper}
+	return mapper
+}